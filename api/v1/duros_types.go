@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -51,6 +52,41 @@ type DurosSpec struct {
 	MetalProjectID string `json:"metalProjectID,omitempty"`
 	// StorageClasses defines what storageclasses should be deployed
 	StorageClasses []StorageClass `json:"storageClasses,omitempty"`
+	// ProjectMetadata describes the owner of the duros project, it is written into the description of the duros project
+	ProjectMetadata *ProjectMetadata `json:"projectMetadata,omitempty"`
+	// Quota limits the storage the project may consume
+	Quota *Quota `json:"quota,omitempty"`
+	// SnapshotClasses defines what volumesnapshotclasses should be deployed,
+	// if empty a default volumesnapshotclass partition-snapshot with deletion policy Delete is deployed
+	SnapshotClasses []SnapshotClass `json:"snapshotClasses,omitempty"`
+	// VolumeAttributesClasses defines what volumeattributesclasses should be deployed, claims can be moved between them without re-provisioning.
+	// They are only deployed if the shoot serves volumeattributesclasses.
+	VolumeAttributesClasses []VolumeAttributesClass `json:"volumeAttributesClasses,omitempty"`
+}
+
+// Quota limits the storage of a project, unset fields are unlimited
+type Quota struct {
+	// Capacity is the total provisioned capacity of all volumes
+	Capacity *resource.Quantity `json:"capacity,omitempty" description:"the total provisioned capacity of all volumes"`
+	// Volumes is the number of volumes
+	Volumes *int `json:"volumes,omitempty" description:"the number of volumes"`
+	// Snapshots is the number of snapshots
+	Snapshots *int `json:"snapshots,omitempty" description:"the number of snapshots"`
+}
+
+// ProjectMetadata describes to whom a duros project belongs.
+// A duros project is shared by all clusters of a metal project, the clusters are added to the list of clusters of the project.
+type ProjectMetadata struct {
+	// Tenant is the metal tenant the project belongs to
+	Tenant string `json:"tenant,omitempty" description:"the metal tenant of the project"`
+	// ProjectName is the name of the metal project
+	ProjectName string `json:"projectName,omitempty" description:"the name of the metal project"`
+	// Partition is the metal partition of the lightos cluster
+	Partition string `json:"partition,omitempty" description:"the metal partition of the lightos cluster"`
+	// ClusterName is the name of the cluster this resource belongs to
+	ClusterName string `json:"clusterName,omitempty" description:"the name of the cluster"`
+	// Seed is the name of the seed the cluster is running in
+	Seed string `json:"seed,omitempty" description:"the name of the seed of the cluster"`
 }
 
 // DurosStatus defines the observed state of Duros
@@ -59,6 +95,176 @@ type DurosStatus struct {
 	ReconcileStatus ReconcileStatus `json:"reconcileStatus" description:"The current status of the reconciliation of this resource"`
 	// ManagedResourceStatuses contains a list of statuses of resources managed by this controller
 	ManagedResourceStatuses []ManagedResourceStatus `json:"managedResourceStatuses" description:"A list of managed resource statuses"`
+	// Quota reports the usage of the project against its quota, it is only set if a quota is configured
+	Quota *QuotaStatus `json:"quota,omitempty" description:"The usage of the project against its quota"`
+	// Volumes summarizes the volumes of the project in all used backends
+	Volumes *VolumesStatus `json:"volumes,omitempty" description:"A summary of the volumes of the project"`
+	// OrphanedVolumes are detached volumes of the project which are not referenced by a persistent volume of the shoot
+	OrphanedVolumes []OrphanedVolume `json:"orphanedVolumes,omitempty" description:"Detached volumes which are not used by the shoot"`
+	// OrphanedVolumesTruncated is set if not all orphaned volumes are listed in orphanedVolumes
+	OrphanedVolumesTruncated bool `json:"orphanedVolumesTruncated,omitempty" description:"If set not all orphaned volumes are listed"`
+	// ProvisioningFailures aggregates the recent provisioning failures of claims of the managed storage classes in the shoot by reason
+	ProvisioningFailures []ProvisioningFailure `json:"provisioningFailures,omitempty" description:"Recent provisioning failures of persistent volume claims by reason"`
+	// Backends reports the health of the lightos clusters used by this resource
+	Backends []BackendStatus `json:"backends,omitempty" description:"The health of the used lightos clusters"`
+	// Conditions describe the current state of this resource
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" description:"The conditions of this resource"`
+}
+
+const (
+	// ConditionBackendsHealthy is true if all used lightos clusters are reachable and all their servers are active
+	ConditionBackendsHealthy = "BackendsHealthy"
+	// ConditionStorageClassesReady is false if a storage class can not be provisioned, e.g. it requests more replicas than its backend allows
+	ConditionStorageClassesReady = "StorageClassesReady"
+	// ConditionVersionsCompatible is false if no csi images are known to support the kubernetes version of the shoot
+	ConditionVersionsCompatible = "VersionsCompatible"
+	// ConditionQuotaEnforced is true if the quota is enforced in the shoot, false if it is only reported
+	ConditionQuotaEnforced = "QuotaEnforced"
+	// ConditionVolumeAttributesClassesReady is false if volumeattributesclasses are not supported by the shoot or wait to be replaced
+	ConditionVolumeAttributesClassesReady = "VolumeAttributesClassesReady"
+)
+
+// BackendStatus reports the health of a lightos cluster
+type BackendStatus struct {
+	// Name is the name of the backend
+	Name string `json:"name" description:"The name of the backend"`
+	// APIVersion is the version of the duros api
+	APIVersion string `json:"apiVersion,omitempty" description:"The version of the duros api"`
+	// Healthy is true if the cluster is reachable and all servers are active
+	Healthy bool `json:"healthy" description:"Whether the cluster is healthy"`
+	// State is the health state of the cluster
+	State BackendState `json:"state,omitempty" description:"The health state of the cluster"`
+	// Servers is the number of servers of the cluster
+	Servers int `json:"servers" description:"The number of servers"`
+	// ActiveServers is the number of servers in state active
+	ActiveServers int `json:"activeServers" description:"The number of active servers"`
+	// MaxReplicas is the maximum number of replicas a volume can currently have
+	MaxReplicas int `json:"maxReplicas" description:"The maximum number of replicas of a volume"`
+	// DegradedVolumes is the number of volumes of the project in this cluster which are not fully protected
+	DegradedVolumes int `json:"degradedVolumes" description:"The number of volumes of the project which are not fully protected"`
+	// RebuildingVolumes is the number of volumes of the project in this cluster whose replicas are rebuilt
+	RebuildingVolumes int `json:"rebuildingVolumes" description:"The number of volumes of the project whose replicas are rebuilt"`
+	// Message describes why the cluster is not healthy
+	Message string `json:"message,omitempty" description:"Why the cluster is not healthy"`
+	// LastUpdateTime is the last time the health of the cluster was polled
+	LastUpdateTime metav1.Time `json:"lastUpdateTime" description:"The time when the health was polled"`
+}
+
+// BackendState is the health state of a lightos cluster
+type BackendState string
+
+const (
+	// BackendStateHealthy means the cluster is reachable and all servers are active
+	BackendStateHealthy BackendState = "Healthy"
+	// BackendStateDegraded means the cluster is reachable but not all servers are active
+	BackendStateDegraded BackendState = "Degraded"
+	// BackendStateUnreachable means the version or the cluster info could not be read from the duros api
+	BackendStateUnreachable BackendState = "Unreachable"
+)
+
+// OrphanedVolume is a detached volume which is not referenced by a persistent volume of the shoot
+type OrphanedVolume struct {
+	// Name is the name of the volume
+	Name string `json:"name" description:"The name of the volume"`
+	// UUID is the id of the volume
+	UUID string `json:"uuid" description:"The id of the volume"`
+	// Backend is the name of the backend the volume is provisioned in
+	Backend string `json:"backend" description:"The backend of the volume"`
+	// Size is the provisioned size of the volume
+	Size resource.Quantity `json:"size" description:"The provisioned size of the volume"`
+	// FirstSeen is the time the volume was detected as orphaned for the first time
+	FirstSeen metav1.Time `json:"firstSeen" description:"The time the volume was detected as orphaned"`
+	// Owned is set if the volume was used by a persistent volume of this shoot before it was orphaned, only owned volumes are cleaned up
+	Owned bool `json:"owned,omitempty" description:"Whether the volume was used by this shoot before it was orphaned"`
+}
+
+// ProvisioningFailureReason classifies why the csi provisioner failed to create a volume
+type ProvisioningFailureReason string
+
+const (
+	// ProvisioningFailureUnauthenticated means the token of the storage class was rejected, e.g. because it expired
+	ProvisioningFailureUnauthenticated = ProvisioningFailureReason("Unauthenticated")
+	// ProvisioningFailureQuotaExceeded means the volume exceeds the quota of the project
+	ProvisioningFailureQuotaExceeded = ProvisioningFailureReason("QuotaExceeded")
+	// ProvisioningFailureInsufficientCapacity means the backend has no space left for the volume
+	ProvisioningFailureInsufficientCapacity = ProvisioningFailureReason("InsufficientCapacity")
+	// ProvisioningFailureInvalidReplicaCount means the backend can not place the replicas of the storage class
+	ProvisioningFailureInvalidReplicaCount = ProvisioningFailureReason("InvalidReplicaCount")
+	// ProvisioningFailureBackendUnavailable means the duros api was not reachable from the csi controller
+	ProvisioningFailureBackendUnavailable = ProvisioningFailureReason("BackendUnavailable")
+	// ProvisioningFailurePending means the claim waits for the csi provisioner longer than expected without a failure being reported
+	ProvisioningFailurePending = ProvisioningFailureReason("Pending")
+	// ProvisioningFailureOther are all failures which are not classified
+	ProvisioningFailureOther = ProvisioningFailureReason("Other")
+)
+
+// ProvisioningFailure aggregates the claims whose provisioning failed for the same reason
+type ProvisioningFailure struct {
+	// Reason is the classified reason of the failures
+	Reason ProvisioningFailureReason `json:"reason" description:"The classified reason of the failures"`
+	// Count is the number of affected claims
+	Count int `json:"count" description:"The number of affected persistent volume claims"`
+	// StorageClasses are the storage classes of the affected claims
+	StorageClasses []string `json:"storageClasses,omitempty" description:"The storage classes of the affected claims"`
+	// Claims are some of the affected claims as namespace/name
+	Claims []string `json:"claims,omitempty" description:"Some of the affected persistent volume claims"`
+	// Message is the message of the most recent failure
+	Message string `json:"message,omitempty" description:"The message of the most recent failure"`
+	// LastTimestamp is the time of the most recent failure
+	LastTimestamp metav1.Time `json:"lastTimestamp" description:"The time of the most recent failure"`
+}
+
+// VolumesStatus summarizes the volumes and snapshots of a project
+type VolumesStatus struct {
+	// Count is the number of volumes
+	Count int `json:"count" description:"The number of volumes"`
+	// SnapshotCount is the number of snapshots
+	SnapshotCount int `json:"snapshotCount" description:"The number of snapshots"`
+	// ProvisionedCapacity is the sum of the sizes of all volumes
+	ProvisionedCapacity resource.Quantity `json:"provisionedCapacity" description:"The sum of the sizes of all volumes"`
+	// Items lists the volumes, the list is truncated for projects with many volumes.
+	// The persistent volumes and claims of the shoot are not watched, their changes show up with the next reconciliation within 30 seconds.
+	Items []VolumeStatus `json:"items,omitempty" description:"The volumes of the project, changes of persistent volumes and claims in the shoot show up within 30 seconds"`
+	// Truncated is true if not all volumes are contained in items
+	Truncated bool `json:"truncated,omitempty" description:"If set not all volumes are listed in items"`
+	// LastUpdateTime is the last time the volumes and the persistent volumes and claims of the shoot were listed
+	LastUpdateTime metav1.Time `json:"lastUpdateTime" description:"The time when the volumes and the persistent volumes and claims of the shoot were listed"`
+}
+
+// VolumeStatus describes a single volume
+type VolumeStatus struct {
+	// Name is the name of the volume
+	Name string `json:"name" description:"The name of the volume"`
+	// UUID is the id of the volume
+	UUID string `json:"uuid" description:"The id of the volume"`
+	// Backend is the name of the backend the volume is provisioned in
+	Backend string `json:"backend" description:"The backend of the volume"`
+	// Size is the provisioned size of the volume
+	Size resource.Quantity `json:"size" description:"The provisioned size of the volume"`
+	// Replicas is the number of replicas of the volume
+	Replicas int `json:"replicas" description:"The number of replicas"`
+	// State is the state of the volume in lightos
+	State string `json:"state" description:"The state of the volume"`
+	// ProtectionState is the protection state of the volume in lightos
+	ProtectionState string `json:"protectionState" description:"The protection state of the volume"`
+	// PersistentVolume is the name of the persistent volume in the shoot which uses the volume
+	PersistentVolume string `json:"persistentVolume,omitempty" description:"The persistent volume which uses the volume"`
+	// Claim is the namespace and name of the persistent volume claim bound to the persistent volume
+	Claim string `json:"claim,omitempty" description:"The persistent volume claim of the volume"`
+	// Labels are the selected labels of the persistent volume claim
+	Labels map[string]string `json:"labels,omitempty" description:"The selected labels of the persistent volume claim"`
+}
+
+// QuotaStatus reports the usage of a project against its quota
+type QuotaStatus struct {
+	// Hard is the configured quota
+	Hard Quota `json:"hard" description:"The configured quota"`
+	// Used is the current usage of the project in all backends
+	Used Quota `json:"used" description:"The current usage of the project"`
+	// Exceeded contains the names of the exceeded limits
+	Exceeded []string `json:"exceeded,omitempty" description:"The names of the exceeded limits"`
 }
 
 type ManagedResourceStatus struct {
@@ -98,6 +304,26 @@ type StorageClass struct {
 	Compression  bool   `json:"compression"`
 	Default      bool   `json:"default" description:"if set to true this storageclass is configured as default"`
 	Encryption   bool   `json:"encryption,omitempty"`
+	// Backend is the name of the lightos cluster the volumes of this storageclass are provisioned from, defaults to the default backend
+	Backend string `json:"backend,omitempty" description:"the name of the lightos cluster the volumes are provisioned from"`
+}
+
+type SnapshotClass struct {
+	Name string `json:"name"`
+	// DeletionPolicy defines if the snapshot is deleted together with its volumesnapshotcontent, defaults to Delete
+	// +kubebuilder:validation:Enum=Delete;Retain
+	DeletionPolicy string `json:"deletionPolicy,omitempty" description:"Delete or Retain the snapshot in lightos when the volumesnapshotcontent is deleted"`
+	Default        bool   `json:"default,omitempty" description:"if set to true this volumesnapshotclass is configured as default"`
+	// Backend is the name of the lightos cluster the snapshots are taken in, defaults to the default backend
+	Backend string `json:"backend,omitempty" description:"the name of the lightos cluster the snapshots are taken in"`
+}
+
+// VolumeAttributesClass defines the mutable parameters of a volume
+type VolumeAttributesClass struct {
+	// Name is the name of the volumeattributesclass in the shoot which is referenced by volumeAttributesClassName of claims
+	Name string `json:"name" description:"the name of the volumeattributesclass in the shoot"`
+	// QoSPolicyName is the name of the lightos qos policy applied to the volumes of this class
+	QoSPolicyName string `json:"qosPolicyName" description:"the name of the lightos qos policy of the volumes"`
 }
 
 func init() {
@@ -0,0 +1,84 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SnapshotSchedule periodically takes volume snapshots of the persistent volume claims in its namespace.
+// It is deployed into the shoot and created by the users of the shoot.
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="LastSuccess",type=date,JSONPath=`.status.lastSuccessTime`
+// +kubebuilder:printcolumn:name="LastFailure",type=date,JSONPath=`.status.lastFailureTime`
+// +kubebuilder:subresource:status
+type SnapshotSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SnapshotScheduleSpec   `json:"spec,omitempty"`
+	Status SnapshotScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SnapshotScheduleList contains a list of SnapshotSchedule
+type SnapshotScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SnapshotSchedule `json:"items"`
+}
+
+// SnapshotScheduleSpec defines which persistent volume claims are snapshotted when and how long the snapshots are kept
+type SnapshotScheduleSpec struct {
+	// Selector selects the persistent volume claims in the namespace of the schedule
+	Selector metav1.LabelSelector `json:"selector" description:"selects the persistent volume claims to snapshot"`
+	// Schedule is a cron expression like 0 3 * * *
+	Schedule string `json:"schedule" description:"the cron expression when snapshots are taken"`
+	// Retention defines which snapshots are deleted, without retention snapshots are never deleted
+	Retention *SnapshotRetention `json:"retention,omitempty" description:"how long snapshots are kept"`
+	// SnapshotClassName is the volumesnapshotclass of the snapshots, the default volumesnapshotclass is used if empty
+	SnapshotClassName string `json:"snapshotClassName,omitempty" description:"the volumesnapshotclass of the snapshots"`
+}
+
+// SnapshotRetention limits the snapshots kept per persistent volume claim, a snapshot is deleted if any limit is exceeded
+type SnapshotRetention struct {
+	// Count is the maximum number of snapshots per persistent volume claim
+	// +kubebuilder:validation:Minimum=1
+	Count *int `json:"count,omitempty" description:"the maximum number of snapshots per persistent volume claim"`
+	// MaxAge is the maximum age of a snapshot, e.g. 168h
+	MaxAge *metav1.Duration `json:"maxAge,omitempty" description:"the maximum age of a snapshot"`
+}
+
+// SnapshotScheduleStatus reports the last run of the schedule
+type SnapshotScheduleStatus struct {
+	// LastScheduleTime is the last time snapshots were taken
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty" description:"The last time snapshots were taken"`
+	// LastSuccessTime is the last time all snapshots were created successfully
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty" description:"The last time all snapshots were created"`
+	// LastFailureTime is the last time creating or deleting snapshots failed
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty" description:"The last time the schedule failed"`
+	// LastFailureMessage describes the last failure
+	LastFailureMessage string `json:"lastFailureMessage,omitempty" description:"The reason of the last failure"`
+	// Snapshots is the number of snapshots currently kept by this schedule
+	Snapshots int `json:"snapshots" description:"The number of snapshots kept by this schedule"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SnapshotSchedule{}, &SnapshotScheduleList{})
+}
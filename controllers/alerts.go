@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const prometheusRuleName = "duros-controller-alerts"
+
+// prometheusRuleGVK is used with unstructured objects, the prometheus operator api is not a dependency of this controller
+var prometheusRuleGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PrometheusRule"}
+
+// AlertThresholds configure the alerts of the PrometheusRule deployed next to the controller
+type AlertThresholds struct {
+	// TokenExpiry alerts if the storage class token expires within this duration, it is renewed one day before it expires
+	TokenExpiry time.Duration
+	// DaemonSetDegraded alerts if the csi node daemonset is not running for this duration
+	DaemonSetDegraded time.Duration
+	// APIUnreachable alerts if no duros api endpoint is reachable for this duration
+	APIUnreachable time.Duration
+	// ReconcileErrors alerts if reconcile steps fail for this duration
+	ReconcileErrors time.Duration
+}
+
+// reconcilePrometheusRule deploys the alerts on the metrics of this controller into its namespace in the seed,
+// the rule is deleted if no thresholds are configured. Nothing is done if the prometheus operator is not installed.
+func (r *DurosReconciler) reconcilePrometheusRule(ctx context.Context) error {
+	log := r.Log.WithName("prometheus-rule")
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(prometheusRuleGVK)
+	obj.SetName(prometheusRuleName)
+	obj.SetNamespace(r.Namespace)
+
+	if r.PrometheusRule == nil {
+		// the alerts can only be enabled by a restart, deleting the rule once is enough
+		if r.prometheusRuleDeleted.Load() {
+			return nil
+		}
+		err := r.Delete(ctx, obj)
+		if err != nil && !meta.IsNoMatchError(err) && client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to delete prometheusrule: %w", err)
+		}
+		if err == nil {
+			log.Info("prometheusrule", "name", prometheusRuleName, "operation", "deleted")
+		}
+		r.prometheusRuleDeleted.Store(true)
+		return nil
+	}
+
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, obj, func() error {
+		mergeAnnotations(obj, map[string]string{
+			metalClusterDescriptionTag: durosDoNotEditMessage,
+		})
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		maps.Copy(labels, r.PrometheusRuleLabels)
+		obj.SetLabels(labels)
+		obj.Object["spec"] = map[string]any{
+			"groups": []any{
+				map[string]any{
+					"name":  "duros-controller",
+					"rules": alertingRules(r.Namespace, *r.PrometheusRule),
+				},
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			log.Info("prometheusrules are not supported by the seed, not deploying alerts")
+			return nil
+		}
+		return fmt.Errorf("unable to deploy prometheusrule: %w", err)
+	}
+	log.Info("prometheusrule", "name", prometheusRuleName, "operation", op)
+	return nil
+}
+
+// alertingRules returns the rules on the metrics of the controller in the given namespace
+func alertingRules(namespace string, t AlertThresholds) []any {
+	rule := func(alert, expr string, duration time.Duration, severity, summary string) map[string]any {
+		return map[string]any{
+			"alert": alert,
+			"expr":  expr,
+			"for":   promDuration(duration),
+			"labels": map[string]any{
+				"severity": severity,
+			},
+			"annotations": map[string]any{
+				"summary": summary,
+			},
+		}
+	}
+	return []any{
+		rule("DurosStorageClassTokenExpiring",
+			fmt.Sprintf(`min by (backend) (%s_storage_class_token_expiry_timestamp_seconds{namespace=%q}) - time() < %d`, metricsNamespace, namespace, int64(t.TokenExpiry.Seconds())),
+			10*time.Minute, "warning",
+			fmt.Sprintf("The storage class token of backend {{ $labels.backend }} expires within %s and was not renewed.", t.TokenExpiry)),
+		rule("DurosCSINodeDegraded",
+			fmt.Sprintf(`%s_managed_resource_healthy{namespace=%q,kind="DaemonSet"} == 0`, metricsNamespace, namespace),
+			t.DaemonSetDegraded, "warning",
+			"The csi node daemonset in the shoot is degraded, volumes can not be mounted on all nodes."),
+		rule("DurosAPIUnreachable",
+			fmt.Sprintf(`max by (backend) (%s_api_endpoint_up{namespace=%q}) == 0`, metricsNamespace, namespace),
+			t.APIUnreachable, "critical",
+			"No endpoint of the duros api of backend {{ $labels.backend }} is reachable."),
+		rule("DurosReconcileErrors",
+			fmt.Sprintf(`sum by (step) (increase(%s_reconcile_step_errors_total{namespace=%q}[10m])) > 0`, metricsNamespace, namespace),
+			t.ReconcileErrors, "warning",
+			"The {{ $labels.step }} step of the duros reconciliation keeps failing."),
+	}
+}
+
+// promDuration formats the duration in seconds, which is understood by prometheus
+func promDuration(d time.Duration) string {
+	return fmt.Sprintf("%ds", int64(d.Seconds()))
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestReconcilePrometheusRule(t *testing.T) {
+	var deletes int
+	seed := interceptor.NewClient(newFakeClient().(client.WithWatch), interceptor.Funcs{
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			deletes++
+			return c.Delete(ctx, obj, opts...)
+		},
+	})
+	r := &DurosReconciler{
+		Client:               seed,
+		Log:                  logr.Discard(),
+		Namespace:            "shoot--p--c",
+		PrometheusRule:       &AlertThresholds{TokenExpiry: 12 * time.Hour},
+		PrometheusRuleLabels: map[string]string{"prometheus": "seed"},
+	}
+
+	err := r.reconcilePrometheusRule(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := &unstructured.Unstructured{}
+	rule.SetGroupVersionKind(prometheusRuleGVK)
+	err = seed.Get(context.Background(), client.ObjectKey{Namespace: r.Namespace, Name: prometheusRuleName}, rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rule.GetLabels()["prometheus"]; got != "seed" {
+		t.Errorf("label prometheus = %q, want seed", got)
+	}
+
+	// disabled alerts delete the rule only once
+	r.PrometheusRule = nil
+	for range 3 {
+		err = r.reconcilePrometheusRule(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if deletes != 1 {
+		t.Errorf("deletes = %d, want 1", deletes)
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"fmt"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+// DefaultBackend is the name of the backend configured with the command line flags,
+// it is used by storage classes which do not reference a backend.
+const DefaultBackend = "default"
+
+// Backend is a lightos cluster storage classes can be provisioned from
+type Backend struct {
+	Name     string
+	Client   durosv2.DurosAPIClient
+	AdminKey []byte
+	// Endpoints are used as mgmt-endpoint of the storage classes
+	Endpoints string
+	// EndpointDiscovery if set, provides the endpoints instead of the static Endpoints
+	EndpointDiscovery *EndpointDiscovery
+	// HealthMonitor if set, provides the health of the lightos cluster
+	HealthMonitor *HealthMonitor
+}
+
+// mgmtEndpoints returns the endpoints the storage classes of this backend should point to
+func (b *Backend) mgmtEndpoints() string {
+	if b.EndpointDiscovery != nil {
+		if endpoints := b.EndpointDiscovery.Endpoints(); endpoints != "" {
+			return endpoints
+		}
+	}
+	return b.Endpoints
+}
+
+// credentialsRef returns the name of the secret in the shoot which holds the token for this backend
+func (b *Backend) credentialsRef() string {
+	if b.Name == DefaultBackend {
+		return storageClassCredentialsRef
+	}
+	return storageClassCredentialsRef + "-" + b.Name
+}
+
+// backend returns the backend with the given name, an empty name refers to the default backend
+func (r *DurosReconciler) backend(name string) (*Backend, error) {
+	if name == "" {
+		name = DefaultBackend
+	}
+	b, ok := r.Backends[name]
+	if !ok {
+		return nil, fmt.Errorf("backend %q is not configured", name)
+	}
+	return b, nil
+}
+
+// usedBackends returns the backends referenced by the given storage classes and snapshot classes.
+// The default backend is always contained because its credentials are mounted into the csi plugin.
+func (r *DurosReconciler) usedBackends(scs []storagev1.StorageClass, snapshotClasses []storagev1.SnapshotClass) ([]*Backend, error) {
+	defaultBackend, err := r.backend(DefaultBackend)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		backends = []*Backend{defaultBackend}
+		seen     = map[string]bool{DefaultBackend: true}
+	)
+	for _, sc := range scs {
+		b, err := r.backend(sc.Backend)
+		if err != nil {
+			return nil, fmt.Errorf("storageclass %s: %w", sc.Name, err)
+		}
+		if seen[b.Name] {
+			continue
+		}
+		seen[b.Name] = true
+		backends = append(backends, b)
+	}
+	for _, sc := range snapshotClasses {
+		b, err := r.backend(sc.Backend)
+		if err != nil {
+			return nil, fmt.Errorf("snapshotclass %s: %w", sc.Name, err)
+		}
+		if seen[b.Name] {
+			continue
+		}
+		seen[b.Name] = true
+		backends = append(backends, b)
+	}
+	return backends, nil
+}
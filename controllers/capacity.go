@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	storage "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+const (
+	// capacityManagedByLabel marks the csistoragecapacities published by this controller
+	capacityManagedByLabel = "csi.storage.k8s.io/managed-by"
+	capacityManagedBy      = "duros-controller"
+	capacityDriverLabel    = "csi.storage.k8s.io/drivername"
+	capacityPrefix         = "lb-csi-"
+)
+
+// reconcileStorageCapacities publishes the capacity available to every storage class, the scheduler uses it
+// to not place pods with WaitForFirstConsumer claims on a full lightos cluster.
+// The free physical storage of the backend is divided by the replicas of the storage class and limited by the remaining quota.
+func (r *DurosReconciler) reconcileStorageCapacities(ctx context.Context, scs []storagev1.StorageClass, quota *storagev1.QuotaStatus) error {
+	log := r.Log.WithName("storage-capacity")
+
+	existing := &storage.CSIStorageCapacityList{}
+	err := r.Shoot.List(ctx, existing, client.InNamespace(namespace), client.MatchingLabels{capacityManagedByLabel: capacityManagedBy})
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			log.Info("csistoragecapacities are not supported by the shoot, not publishing storage capacity")
+			return nil
+		}
+		return fmt.Errorf("unable to list csistoragecapacities: %w", err)
+	}
+
+	var remaining *resource.Quantity
+	if quota != nil && quota.Hard.Capacity != nil && quota.Used.Capacity != nil {
+		remaining = new(quota.Hard.Capacity.DeepCopy())
+		remaining.Sub(*quota.Used.Capacity)
+		if remaining.Sign() < 0 {
+			remaining = resource.NewQuantity(0, resource.BinarySI)
+		}
+	}
+
+	clusters := map[string]*durosv2.Cluster{}
+	desired := map[string]bool{}
+	for _, sc := range scs {
+		b, err := r.backend(sc.Backend)
+		if err != nil {
+			return err
+		}
+		cluster, ok := clusters[b.Name]
+		if !ok {
+			cluster, err = b.Client.GetClusterInfo(ctx, &durosv2.GetClusterRequest{})
+			if err != nil {
+				return fmt.Errorf("unable to get cluster info of backend %s: %w", b.Name, err)
+			}
+			clusters[b.Name] = cluster
+		}
+
+		free := cluster.GetStatistics().GetFreePhysicalStorage() / uint64(max(sc.ReplicaCount, 1)) //nolint:gosec
+		capacity := resource.NewQuantity(int64(free), resource.BinarySI)                           //nolint:gosec
+		if remaining != nil && remaining.Cmp(*capacity) < 0 {
+			capacity = new(remaining.DeepCopy())
+		}
+
+		obj := &storage.CSIStorageCapacity{ObjectMeta: metav1.ObjectMeta{Name: capacityPrefix + sc.Name, Namespace: namespace}}
+		desired[obj.Name] = true
+		op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, obj, func() error {
+			obj.Labels = map[string]string{
+				capacityManagedByLabel: capacityManagedBy,
+				capacityDriverLabel:    provisioner,
+			}
+			obj.Annotations = map[string]string{
+				metalClusterDescriptionTag: durosDoNotEditMessage,
+			}
+			obj.StorageClassName = sc.Name
+			// all nodes have access to the storage over the network
+			obj.NodeTopology = &metav1.LabelSelector{}
+			obj.Capacity = capacity
+			return nil
+		})
+		if err != nil {
+			if apierrors.IsInvalid(err) {
+				// storage class name and topology are immutable, recreated on the next reconciliation
+				deleteErr := r.Shoot.Delete(ctx, obj)
+				if deleteErr != nil {
+					return deleteErr
+				}
+				log.Info("csistoragecapacity", "name", obj.Name, "operation", "deleted")
+			}
+			return err
+		}
+		log.Info("csistoragecapacity", "name", obj.Name, "capacity", capacity.String(), "operation", op)
+	}
+
+	for i := range existing.Items {
+		obj := &existing.Items[i]
+		if desired[obj.Name] {
+			continue
+		}
+		err = r.Shoot.Delete(ctx, obj)
+		if client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to delete csistoragecapacity %s: %w", obj.Name, err)
+		}
+		log.Info("csistoragecapacity", "name", obj.Name, "operation", "deleted")
+	}
+	return nil
+}
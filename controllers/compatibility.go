@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+// imageSet are the images of the csi plugin and its sidecars
+type imageSet struct {
+	lbCSIPlugin            string
+	lbDiscoveryClient      string
+	csiProvisioner         string
+	csiAttacher            string
+	csiResizer             string
+	csiNodeDriverRegistrar string
+	snapshotController     string
+	csiSnapshotter         string
+	livenessProbe          string
+	csiHealthMonitor       string
+}
+
+// compatibility is an entry of the compatibilityMatrix
+type compatibility struct {
+	kubernetes versionRange
+	// lightos is the range of lightos api versions, every used backend must be inside it
+	lightos versionRange
+	images  imageSet
+	// groupSnapshots are the versions in which volume group snapshots are enabled, nil if the images do not support them
+	groupSnapshots *featureSupport
+	// volumeAttributesClasses are the versions in which volumes can be modified with volumeattributesclasses, nil if the images do not support it
+	volumeAttributesClasses *featureSupport
+}
+
+// featureSupport are the versions which support an optional feature, all ranges must contain the versions in use
+type featureSupport struct {
+	kubernetes versionRange
+	lightos    versionRange
+	// plugin is the range of versions of the lb-csi-plugin image
+	plugin versionRange
+}
+
+// supports returns true if the feature is supported by the kubernetes version, all lightos api versions and the image
+// of the lb-csi-plugin, a nil feature is not supported
+func (f *featureSupport) supports(kubernetes minorVersion, lightos []minorVersion, pluginImage string) bool {
+	if f == nil || !f.kubernetes.contains(kubernetes) {
+		return false
+	}
+	if slices.ContainsFunc(lightos, func(v minorVersion) bool { return !f.lightos.contains(v) }) {
+		return false
+	}
+	if f.plugin == (versionRange{}) {
+		return true
+	}
+	plugin, err := imageVersion(pluginImage)
+	return err == nil && f.plugin.contains(plugin)
+}
+
+// features are optional features of the csi deployment which depend on the kubernetes version of the shoot, the
+// lightos api versions of its backends and the images of the matching compatibility entry
+type features struct {
+	groupSnapshots          bool
+	volumeAttributesClasses bool
+}
+
+// versionRange is an inclusive range of major.minor versions, an empty bound is unlimited,
+// a max without minor version includes all minor versions of the major version
+type versionRange struct {
+	min string
+	max string
+}
+
+var versionRegex = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?`)
+
+// minorVersion is the major and minor part of a version
+type minorVersion struct {
+	major int
+	minor int
+}
+
+func parseMinorVersion(version string) (minorVersion, error) {
+	m := versionRegex.FindStringSubmatch(strings.TrimSpace(version))
+	if m == nil {
+		return minorVersion{}, fmt.Errorf("unable to parse version %q", version)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return minorVersion{major: major, minor: minor}, nil
+}
+
+// imageVersion parses the major and minor version of the tag of the image
+func imageVersion(image string) (minorVersion, error) {
+	_, tag, ok := strings.Cut(image[strings.LastIndex(image, "/")+1:], ":")
+	if !ok {
+		return minorVersion{}, fmt.Errorf("image %q has no tag", image)
+	}
+	return parseMinorVersion(tag)
+}
+
+func (v minorVersion) compare(o minorVersion) int {
+	if v.major != o.major {
+		return v.major - o.major
+	}
+	return v.minor - o.minor
+}
+
+func (v minorVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// contains returns true if the version is inside the range
+func (r versionRange) contains(v minorVersion) bool {
+	if r.min != "" {
+		minVersion, err := parseMinorVersion(r.min)
+		if err != nil || v.compare(minVersion) < 0 {
+			return false
+		}
+	}
+	if r.max != "" {
+		maxVersion, err := parseMinorVersion(r.max)
+		if err != nil {
+			return false
+		}
+		if !strings.Contains(r.max, ".") {
+			return v.major <= maxVersion.major
+		}
+		return v.compare(maxVersion) <= 0
+	}
+	return true
+}
+
+// image returns the image of the container with the given name, an empty string for unknown containers
+func (i imageSet) image(container string) string {
+	switch container {
+	case csiPluginContainer.Name, nodeInitContainer.Name:
+		return i.lbCSIPlugin
+	case discoveryClientContainer.Name:
+		return i.lbDiscoveryClient
+	case csiProvisionerContainer.Name:
+		return i.csiProvisioner
+	case csiAttacherContainer.Name:
+		return i.csiAttacher
+	case csiResizerContainer.Name:
+		return i.csiResizer
+	case csiNodeDriverRegistrarContainer.Name:
+		return i.csiNodeDriverRegistrar
+	case snapshotControllerContainer.Name:
+		return i.snapshotController
+	case csiSnapshotterContainer.Name:
+		return i.csiSnapshotter
+	case livenessProbeContainer.Name:
+		return i.livenessProbe
+	case csiHealthMonitorContainer.Name:
+		return i.csiHealthMonitor
+	default:
+		return ""
+	}
+}
+
+// apply returns copies of the containers with the images of this set
+func (i imageSet) apply(containers []corev1.Container) []corev1.Container {
+	result := make([]corev1.Container, 0, len(containers))
+	for _, c := range containers {
+		c = *c.DeepCopy()
+		if image := i.image(c.Name); image != "" {
+			c.Image = image
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// selectImages looks up the images and features for the kubernetes version of the shoot and the lightos api versions
+// of the backends in the compatibilityMatrix and reports the result in the VersionsCompatible condition.
+// An error is returned for unsupported versions, nothing must be deployed then.
+func (r *DurosReconciler) selectImages(duros *storagev1.Duros, backends []*Backend) (imageSet, features, error) {
+	images, features, err := r.lookupImages(backends)
+	condition := metav1.Condition{
+		Type:               storagev1.ConditionVersionsCompatible,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Supported",
+		Message:            fmt.Sprintf("deploying %s", images.lbCSIPlugin),
+		ObservedGeneration: duros.Generation,
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Unsupported"
+		condition.Message = err.Error()
+	}
+	meta.SetStatusCondition(&duros.Status.Conditions, condition)
+	return images, features, err
+}
+
+func (r *DurosReconciler) lookupImages(backends []*Backend) (imageSet, features, error) {
+	info, err := r.ShootDiscovery.ServerVersion()
+	if err != nil {
+		return imageSet{}, features{}, fmt.Errorf("unable to get kubernetes version of the shoot: %w", err)
+	}
+	kubernetes, err := parseMinorVersion(info.GitVersion)
+	if err != nil {
+		return imageSet{}, features{}, err
+	}
+	var lightos []minorVersion
+	for _, b := range backends {
+		if b.HealthMonitor == nil {
+			continue
+		}
+		status := b.HealthMonitor.Status()
+		if status == nil || status.APIVersion == "" {
+			return imageSet{}, features{}, fmt.Errorf("the lightos api version of backend %s is not known yet", b.Name)
+		}
+		v, err := parseMinorVersion(status.APIVersion)
+		if err != nil {
+			return imageSet{}, features{}, fmt.Errorf("lightos api version of backend %s: %w", b.Name, err)
+		}
+		lightos = append(lightos, v)
+	}
+	return lookupCompatibility(compatibilityMatrix, kubernetes, lightos)
+}
+
+// lookupCompatibility returns the images and features of the first entry of the matrix which supports the kubernetes
+// version and all lightos api versions
+func lookupCompatibility(matrix []compatibility, kubernetes minorVersion, lightos []minorVersion) (imageSet, features, error) {
+	for _, c := range matrix {
+		unsupported := slices.ContainsFunc(lightos, func(v minorVersion) bool { return !c.lightos.contains(v) })
+		if !c.kubernetes.contains(kubernetes) || unsupported {
+			continue
+		}
+		return c.images, features{
+			groupSnapshots:          c.groupSnapshots.supports(kubernetes, lightos, c.images.lbCSIPlugin),
+			volumeAttributesClasses: c.volumeAttributesClasses.supports(kubernetes, lightos, c.images.lbCSIPlugin),
+		}, nil
+	}
+	if len(lightos) == 0 {
+		return imageSet{}, features{}, fmt.Errorf("no csi images known to support kubernetes %s", kubernetes)
+	}
+	versions := make([]string, 0, len(lightos))
+	for _, v := range lightos {
+		versions = append(versions, v.String())
+	}
+	return imageSet{}, features{}, fmt.Errorf("no csi images known to support kubernetes %s with lightos api %s", kubernetes, strings.Join(versions, ", "))
+}
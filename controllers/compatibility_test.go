@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestLookupCompatibility(t *testing.T) {
+	matrix := []compatibility{
+		{
+			kubernetes:              versionRange{min: "1.30"},
+			lightos:                 versionRange{min: "2.3", max: "3"},
+			images:                  imageSet{lbCSIPlugin: "registry:5000/lb-csi-plugin:v1.21.0"},
+			groupSnapshots:          &featureSupport{kubernetes: versionRange{min: "1.32"}, lightos: versionRange{min: "3.0"}, plugin: versionRange{min: "1.21"}},
+			volumeAttributesClasses: &featureSupport{kubernetes: versionRange{min: "1.31"}},
+		},
+		{
+			kubernetes: versionRange{min: "1.25"},
+			lightos:    versionRange{min: "2", max: "2"},
+			images:     imageSet{lbCSIPlugin: "old"},
+		},
+	}
+	tests := []struct {
+		version      string
+		lightos      []string
+		wantImage    string
+		wantFeatures features
+		wantErr      bool
+	}{
+		{version: "v1.24.3", lightos: []string{"v2.3"}, wantErr: true},
+		{version: "v1.25.0", lightos: []string{"v2.3"}, wantImage: "old"},
+		{version: "v1.29.10", lightos: []string{"v2.3"}, wantImage: "old"},
+		{version: "v1.30.1", lightos: []string{"v2.3"}, wantImage: "registry:5000/lb-csi-plugin:v1.21.0"},
+		{version: "v1.30.1", lightos: []string{"v2.2"}, wantImage: "old"},
+		{version: "v1.30.1", lightos: []string{"v2.3", "v2.1"}, wantImage: "old"},
+		{version: "v1.30.1", lightos: []string{"v3.1"}, wantImage: "registry:5000/lb-csi-plugin:v1.21.0"},
+		{version: "v1.30.1", lightos: []string{"v4"}, wantErr: true},
+		{version: "v1.30.1", lightos: []string{"v1.9"}, wantErr: true},
+		{version: "v1.30.1", lightos: []string{"v3.1", "v1.9"}, wantErr: true},
+		{version: "v1.30.1", wantImage: "registry:5000/lb-csi-plugin:v1.21.0"},
+		{version: "v1.31.0", lightos: []string{"v2.3"}, wantImage: "registry:5000/lb-csi-plugin:v1.21.0", wantFeatures: features{volumeAttributesClasses: true}},
+		{version: "v1.33.2-gke.1", lightos: []string{"v3.1"}, wantImage: "registry:5000/lb-csi-plugin:v1.21.0", wantFeatures: features{groupSnapshots: true, volumeAttributesClasses: true}},
+		{version: "v1.33.2-gke.1", lightos: []string{"v2.3"}, wantImage: "registry:5000/lb-csi-plugin:v1.21.0", wantFeatures: features{volumeAttributesClasses: true}},
+		{version: "v1.33.2-gke.1", lightos: []string{"v3.1", "v2.3"}, wantImage: "registry:5000/lb-csi-plugin:v1.21.0", wantFeatures: features{volumeAttributesClasses: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version+"/"+strings.Join(tt.lightos, ","), func(t *testing.T) {
+			v, err := parseMinorVersion(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var lightos []minorVersion
+			for _, l := range tt.lightos {
+				lv, err := parseMinorVersion(l)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lightos = append(lightos, lv)
+			}
+			images, features, err := lookupCompatibility(matrix, v, lightos)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if images.lbCSIPlugin != tt.wantImage {
+				t.Errorf("image = %q, want %q", images.lbCSIPlugin, tt.wantImage)
+			}
+			if features != tt.wantFeatures {
+				t.Errorf("features = %+v, want %+v", features, tt.wantFeatures)
+			}
+		})
+	}
+}
+
+func TestFeatureSupport(t *testing.T) {
+	groupSnapshots := &featureSupport{
+		kubernetes: versionRange{min: "1.32"},
+		lightos:    versionRange{min: "2.3", max: "2"},
+		plugin:     versionRange{min: "1.21"},
+	}
+	tests := []struct {
+		name    string
+		feature *featureSupport
+		lightos []minorVersion
+		plugin  string
+		want    bool
+	}{
+		{name: "supported", feature: groupSnapshots, lightos: []minorVersion{{2, 3}}, plugin: "lb-csi-plugin:v1.21.0", want: true},
+		{name: "not supported by the images", lightos: []minorVersion{{2, 3}}, plugin: "lb-csi-plugin:v1.21.0"},
+		{name: "lightos too old", feature: groupSnapshots, lightos: []minorVersion{{2, 2}}, plugin: "lb-csi-plugin:v1.21.0"},
+		{name: "one of the lightos clusters too new", feature: groupSnapshots, lightos: []minorVersion{{2, 3}, {3, 0}}, plugin: "lb-csi-plugin:v1.21.0"},
+		{name: "plugin too old", feature: groupSnapshots, lightos: []minorVersion{{2, 3}}, plugin: "docker.lightbitslabs.com/lightos-csi/lb-csi-plugin:v1.20.1"},
+		{name: "plugin without tag", feature: groupSnapshots, lightos: []minorVersion{{2, 3}}, plugin: "registry:5000/lb-csi-plugin"},
+		{name: "plugin not restricted", feature: &featureSupport{kubernetes: versionRange{min: "1.31"}}, plugin: "registry:5000/lb-csi-plugin", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.feature.supports(minorVersion{1, 33}, tt.lightos, tt.plugin); got != tt.want {
+				t.Errorf("supports() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompatibilityMatrix(t *testing.T) {
+	for _, c := range compatibilityMatrix {
+		for _, container := range []string{csiPluginContainer.Name, csiProvisionerContainer.Name, csiSnapshotterContainer.Name, csiNodeDriverRegistrarContainer.Name} {
+			if c.images.image(container) == "" {
+				t.Errorf("entry for kubernetes %v has no image for %s", c.kubernetes, container)
+			}
+		}
+	}
+}
+
+// serverVersion is a discovery.ServerVersionInterface which returns a fixed version
+type serverVersion string
+
+func (v serverVersion) ServerVersion() (*version.Info, error) {
+	return &version.Info{GitVersion: string(v)}, nil
+}
+
+func TestSelectImages(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     *storagev1.BackendStatus
+		wantStatus metav1.ConditionStatus
+		wantErr    bool
+	}{
+		{
+			name:       "supported lightos api version",
+			status:     &storagev1.BackendStatus{APIVersion: "v2.3"},
+			wantStatus: metav1.ConditionTrue,
+		},
+		{
+			name:       "unsupported lightos api version",
+			status:     &storagev1.BackendStatus{APIVersion: "v1.5"},
+			wantStatus: metav1.ConditionFalse,
+			wantErr:    true,
+		},
+		{
+			name:       "not polled yet",
+			wantStatus: metav1.ConditionFalse,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &DurosReconciler{ShootDiscovery: serverVersion("v1.33.1")}
+			duros := &storagev1.Duros{}
+			backends := []*Backend{{Name: DefaultBackend, HealthMonitor: &HealthMonitor{status: tt.status}}}
+
+			images, _, err := r.selectImages(duros, backends)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && images.lbCSIPlugin != lbCSIPluginImage {
+				t.Errorf("image = %q, want %q", images.lbCSIPlugin, lbCSIPluginImage)
+			}
+			c := meta.FindStatusCondition(duros.Status.Conditions, storagev1.ConditionVersionsCompatible)
+			if c == nil || c.Status != tt.wantStatus {
+				t.Errorf("condition = %v, want status %s", c, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const csiMetricsName = "lb-csi-ctrl-metrics"
+
+// csiMetricsPorts are the ports of the metrics endpoints of the sidecars by container name,
+// the port names are used in the service and must not be longer than 15 characters
+var csiMetricsPorts = map[string]corev1.ContainerPort{
+	csiProvisionerContainer.Name:     {Name: "provisioner", ContainerPort: 8080, Protocol: corev1.ProtocolTCP},
+	csiAttacherContainer.Name:        {Name: "attacher", ContainerPort: 8081, Protocol: corev1.ProtocolTCP},
+	csiResizerContainer.Name:         {Name: "resizer", ContainerPort: 8082, Protocol: corev1.ProtocolTCP},
+	csiSnapshotterContainer.Name:     {Name: "snapshotter", ContainerPort: 8083, Protocol: corev1.ProtocolTCP},
+	snapshotControllerContainer.Name: {Name: "snapshot-ctrl", ContainerPort: 8084, Protocol: corev1.ProtocolTCP},
+}
+
+// serviceMonitorGVK is used with unstructured objects, the prometheus operator api is not a dependency of this controller
+var serviceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+
+// metricsContainers enables the metrics endpoints of the sidecars in the given containers
+func metricsContainers(containers []corev1.Container) {
+	for i := range containers {
+		port, ok := csiMetricsPorts[containers[i].Name]
+		if !ok {
+			continue
+		}
+		containers[i].Args = append(containers[i].Args, fmt.Sprintf("--http-endpoint=:%d", port.ContainerPort))
+		containers[i].Ports = append(containers[i].Ports, port)
+	}
+}
+
+// deployControllerMetrics creates a service for the metrics endpoints of the given containers of the csi controller
+// and a servicemonitor if the prometheus operator is installed in the shoot
+func (r *DurosReconciler) deployControllerMetrics(ctx context.Context, containers []corev1.Container, selector map[string]string) error {
+	log := r.Log.WithName("storage-csi")
+
+	var (
+		ports     []corev1.ServicePort
+		endpoints []any
+	)
+	for _, c := range containers {
+		port, ok := csiMetricsPorts[c.Name]
+		if !ok {
+			continue
+		}
+		ports = append(ports, corev1.ServicePort{
+			Name:       port.Name,
+			Port:       port.ContainerPort,
+			TargetPort: intstr.FromString(port.Name),
+			Protocol:   corev1.ProtocolTCP,
+		})
+		endpoints = append(endpoints, map[string]any{
+			"port": port.Name,
+			"path": "/metrics",
+		})
+	}
+
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: csiMetricsName, Namespace: namespace}}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, svc, func() error {
+		svc.Labels = map[string]string{
+			"app": csiMetricsName,
+		}
+		// the annotations let the prometheus of gardener scrape the service, prometheus.io/port is not set to
+		// scrape all ports of the service
+		svc.Annotations = map[string]string{
+			metalClusterDescriptionTag: durosDoNotEditMessage,
+			"prometheus.io/scrape":     "true",
+			"prometheus.io/path":       "/metrics",
+			"prometheus.io/name":       csiMetricsName,
+		}
+		svc.Spec.Selector = selector
+		svc.Spec.Ports = ports
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to deploy metrics service: %w", err)
+	}
+	log.Info("service", "name", svc.Name, "operation", op)
+
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	sm.SetName(csiMetricsName)
+	sm.SetNamespace(namespace)
+	op, err = controllerutil.CreateOrUpdate(ctx, r.Shoot, sm, func() error {
+		sm.SetAnnotations(map[string]string{
+			metalClusterDescriptionTag: durosDoNotEditMessage,
+		})
+		sm.Object["spec"] = map[string]any{
+			"selector": map[string]any{
+				"matchLabels": map[string]any{
+					"app": csiMetricsName,
+				},
+			},
+			"endpoints": endpoints,
+		}
+		return nil
+	})
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			log.Info("servicemonitors are not supported by the shoot, only deploying the metrics service")
+			return nil
+		}
+		return fmt.Errorf("unable to deploy servicemonitor: %w", err)
+	}
+	log.Info("servicemonitor", "name", csiMetricsName, "operation", op)
+	return nil
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestDeployControllerMetrics(t *testing.T) {
+	ctx := context.Background()
+	shoot := newFakeClient()
+	r := &DurosReconciler{Log: logr.Discard(), Shoot: shoot}
+
+	containers := []corev1.Container{csiPluginContainer, csiProvisionerContainer, csiResizerContainer}
+	metricsContainers(containers)
+	err := r.deployControllerMetrics(ctx, containers, map[string]string{"app": "lb-csi-plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &corev1.Service{}
+	err = shoot.Get(ctx, client.ObjectKey{Namespace: namespace, Name: csiMetricsName}, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.Annotations["prometheus.io/scrape"] != "true" {
+		t.Errorf("annotations = %v, want the service scraped by prometheus", svc.Annotations)
+	}
+	if _, ok := svc.Annotations["prometheus.io/port"]; ok {
+		t.Errorf("annotations = %v, want all ports scraped", svc.Annotations)
+	}
+	var ports []string
+	for _, p := range svc.Spec.Ports {
+		ports = append(ports, p.Name)
+	}
+	if len(ports) != 2 {
+		t.Errorf("ports = %v, want the ports of the provisioner and the resizer", ports)
+	}
+
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	err = shoot.Get(ctx, client.ObjectKey{Namespace: namespace, Name: csiMetricsName}, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints, _, _ := unstructured.NestedSlice(sm.Object, "spec", "endpoints")
+	if len(endpoints) != 2 {
+		t.Errorf("servicemonitor endpoints = %v, want one per port", endpoints)
+	}
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+)
+
+// EndpointDiscovery periodically pulls the api endpoints from the cluster info of the duros api.
+// They are used as mgmt-endpoint of the storage classes instead of the statically configured endpoints.
+type EndpointDiscovery struct {
+	Log      logr.Logger
+	Client   durosv2.DurosAPIClient
+	Interval time.Duration
+
+	mu        sync.RWMutex
+	endpoints string
+}
+
+// Start discovers the endpoints immediately and then in the configured interval until the context is done
+func (d *EndpointDiscovery) Start(ctx context.Context) error {
+	d.discover(ctx)
+
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			d.discover(ctx)
+		}
+	}
+}
+
+// Endpoints returns the last discovered endpoints in the form host:port,host:port, empty if nothing was discovered yet
+func (d *EndpointDiscovery) Endpoints() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.endpoints
+}
+
+func (d *EndpointDiscovery) discover(ctx context.Context) {
+	cinfo, err := d.Client.GetClusterInfo(ctx, &durosv2.GetClusterRequest{})
+	if err != nil {
+		d.Log.Error(err, "unable to discover endpoints, keeping the last known endpoints", "endpoints", d.Endpoints())
+		return
+	}
+
+	// sorted, otherwise a different order would recreate the storage classes
+	discovered := slices.Clone(cinfo.GetApiEndpoints())
+	slices.Sort(discovered)
+	endpoints := strings.Join(discovered, ",")
+	if endpoints == "" {
+		d.Log.Info("duros api returned no endpoints, keeping the last known endpoints", "endpoints", d.Endpoints())
+		return
+	}
+	// the endpoints end up in the storage classes, they must pass the same checks as configured endpoints
+	if err := ValidateEndpoints(endpoints); err != nil {
+		d.Log.Error(err, "duros api returned invalid endpoints, keeping the last known endpoints", "discovered", endpoints, "endpoints", d.Endpoints())
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.endpoints != endpoints {
+		d.Log.Info("discovered endpoints changed", "old", d.endpoints, "new", endpoints)
+		d.endpoints = endpoints
+	}
+}
+
+// ValidateEndpoints checks that the given endpoints are in the form host:port,host:port
+func ValidateEndpoints(endpoints string) error {
+	for endpoint := range strings.SplitSeq(endpoints, ",") {
+		host, port, err := net.SplitHostPort(strings.TrimSpace(endpoint))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(host) == "" {
+			return fmt.Errorf("invalid empty host")
+		}
+		if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+			return err
+		}
+	}
+	return nil
+}
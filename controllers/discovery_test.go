@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+)
+
+func TestValidateEndpoints(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints string
+		wantErr   bool
+	}{
+		{name: "single", endpoints: "10.0.0.1:443"},
+		{name: "multiple", endpoints: "10.0.0.1:443,10.0.0.2:443"},
+		{name: "spaces", endpoints: "10.0.0.1:443, 10.0.0.2:443"},
+		{name: "hostname", endpoints: "lightos.example.com:443"},
+		{name: "missing port", endpoints: "10.0.0.1", wantErr: true},
+		{name: "empty host", endpoints: ":443", wantErr: true},
+		{name: "invalid port", endpoints: "10.0.0.1:http", wantErr: true},
+		{name: "port out of range", endpoints: "10.0.0.1:70000", wantErr: true},
+		{name: "empty", endpoints: "", wantErr: true},
+		{name: "trailing comma", endpoints: "10.0.0.1:443,", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEndpoints(tt.endpoints)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEndpoints(%q) error = %v, wantErr %v", tt.endpoints, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEndpointDiscoveryKeepsLastKnownEndpoints(t *testing.T) {
+	var discovered []string
+	d := &EndpointDiscovery{
+		Log: logr.Discard(),
+		Client: &fakeDurosClient{getClusterInfo: func() (*durosv2.Cluster, error) {
+			return &durosv2.Cluster{ApiEndpoints: discovered}, nil
+		}},
+	}
+
+	steps := []struct {
+		discovered []string
+		want       string
+	}{
+		{discovered: []string{"10.0.0.2:443", "10.0.0.1:443"}, want: "10.0.0.1:443,10.0.0.2:443"},
+		{discovered: nil, want: "10.0.0.1:443,10.0.0.2:443"},
+		{discovered: []string{"10.0.0.3"}, want: "10.0.0.1:443,10.0.0.2:443"},
+		{discovered: []string{"10.0.0.3:443"}, want: "10.0.0.3:443"},
+	}
+	for i, s := range steps {
+		discovered = s.discovered
+		d.discover(context.Background())
+		if got := d.Endpoints(); got != s.want {
+			t.Errorf("step %d: Endpoints() = %q, want %q", i, got, s.want)
+		}
+	}
+}
@@ -5,17 +5,24 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/retry"
 
 	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
 )
 
-// createProjectIfNotExist check for duros project and create if required
-func (r *DurosReconciler) createProjectIfNotExist(ctx context.Context, projectID string) (*durosv2.Project, error) {
-	p, err := r.DurosClient.GetProject(ctx, &durosv2.GetProjectRequest{Name: projectID})
+// createProjectIfNotExist check for duros project and create if required, the description of an existing project is kept up to date
+func (r *DurosReconciler) createProjectIfNotExist(ctx context.Context, duros *storagev1.Duros, b *Backend, projectID string) (*durosv2.Project, error) {
+	p, err := b.Client.GetProject(ctx, &durosv2.GetProjectRequest{Name: projectID})
 	if err != nil {
 		s, ok := status.FromError(err)
 		if !ok {
@@ -24,20 +31,172 @@ func (r *DurosReconciler) createProjectIfNotExist(ctx context.Context, projectID
 		//nolint
 		switch s.Code() {
 		case codes.NotFound:
-			p, err = r.DurosClient.CreateProject(ctx, &durosv2.CreateProjectRequest{Name: projectID})
+			p, err = b.Client.CreateProject(ctx, &durosv2.CreateProjectRequest{Name: projectID, Description: projectDescription(duros.Spec.ProjectMetadata, "")})
 			if err != nil {
 				return nil, err
 			}
+			r.Recorder.Eventf(duros, corev1.EventTypeNormal, "ProjectCreated", "created project %s in backend %s", projectID, b.Name)
+			return p, nil
 		default:
 			return nil, err
 		}
 	}
+
+	return r.updateProjectDescription(ctx, b, p, func(current string) string {
+		// an empty description means no metadata was given, an existing description is not removed then
+		if description := projectDescription(duros.Spec.ProjectMetadata, current); description != "" {
+			return description
+		}
+		return current
+	})
+}
+
+// errDescriptionConflict is returned if the project description was changed by the controller of another cluster in between
+var errDescriptionConflict = errors.New("the project description was changed concurrently")
+
+// updateProjectDescription sets the description returned by describe for the current description of the project p.
+// The duros api has no conditional updates, therefore the description is read again after the update and
+// the update is retried with the new description if the controller of another cluster changed it in between.
+func (r *DurosReconciler) updateProjectDescription(ctx context.Context, b *Backend, p *durosv2.Project, describe func(current string) string) (*durosv2.Project, error) {
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return errors.Is(err, errDescriptionConflict)
+	}, func() error {
+		description := describe(p.GetDescription())
+		if p.GetDescription() == description {
+			return nil
+		}
+		r.Log.Info("updating project description", "project", p.GetName(), "backend", b.Name, "old", p.GetDescription(), "new", description)
+		_, err := b.Client.UpdateProject(ctx, &durosv2.UpdateProjectRequest{Name: p.GetName(), Description: description})
+		if err != nil {
+			return fmt.Errorf("unable to update project description: %w", err)
+		}
+		p, err = b.Client.GetProject(ctx, &durosv2.GetProjectRequest{Name: p.GetName()})
+		if err != nil {
+			return fmt.Errorf("unable to read updated project description: %w", err)
+		}
+		if p.GetDescription() != description {
+			return errDescriptionConflict
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return p, nil
 }
 
-func (r *DurosReconciler) createProjectCredentialsIfNotExist(ctx context.Context, projectID string, adminKey []byte) (*durosv2.Credential, error) {
+// removeProjectCluster removes the cluster of the duros resource from the description of its project in all used backends.
+// The cluster is gone afterwards, errors are only logged to not block its deletion.
+func (r *DurosReconciler) removeProjectCluster(ctx context.Context, duros *storagev1.Duros) {
+	cluster := projectCluster(duros.Spec.ProjectMetadata)
+	if cluster == "" {
+		return
+	}
+	backends, err := r.usedBackends(duros.Spec.StorageClasses, duros.Spec.SnapshotClasses)
+	if err != nil {
+		r.Log.Error(err, "unable to remove cluster from project description")
+		return
+	}
+	for _, b := range backends {
+		p, err := b.Client.GetProject(ctx, &durosv2.GetProjectRequest{Name: duros.Spec.MetalProjectID})
+		if err == nil {
+			_, err = r.updateProjectDescription(ctx, b, p, func(current string) string {
+				return descriptionWithoutCluster(current, cluster)
+			})
+		}
+		if err != nil && status.Code(err) != codes.NotFound {
+			r.Log.Error(err, "unable to remove cluster from project description", "backend", b.Name, "cluster", cluster)
+		}
+	}
+}
+
+// projectDescription renders the project metadata into the description of the duros project.
+// The project is shared by all clusters of the metal project, the clusters in the current description are kept
+// and the entry of the cluster of the metadata is replaced, otherwise the clusters would overwrite each other on every reconciliation.
+func projectDescription(m *storagev1.ProjectMetadata, current string) string {
+	if m == nil {
+		return ""
+	}
+
+	clusters := descriptionClusters(current)
+	if cluster := projectCluster(m); cluster != "" {
+		// an entry of the cluster in another seed is left from a migration of the cluster
+		clusters = slices.DeleteFunc(clusters, func(c string) bool {
+			name, _, _ := strings.Cut(c, "@")
+			return name == m.ClusterName
+		})
+		clusters = append(clusters, cluster)
+		slices.Sort(clusters)
+	}
+
+	return joinDescription([][2]string{
+		{"tenant", m.Tenant},
+		{"project", m.ProjectName},
+		{"partition", m.Partition},
+		{"clusters", strings.Join(clusters, "|")},
+	})
+}
+
+// descriptionWithoutCluster removes the cluster from the clusters of the project description, the other values are kept.
+// Only the exact entry is removed, after a migration the entry of the cluster in the new seed stays.
+func descriptionWithoutCluster(description, cluster string) string {
+	var kvs [][2]string
+	for kv := range strings.SplitSeq(description, ",") {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "clusters" {
+			continue
+		}
+		kvs = append(kvs, [2]string{key, value})
+	}
+	clusters := slices.DeleteFunc(descriptionClusters(description), func(c string) bool {
+		return c == cluster
+	})
+	return joinDescription(append(kvs, [2]string{"clusters", strings.Join(clusters, "|")}))
+}
+
+// joinDescription joins the key value pairs with a value into a project description
+func joinDescription(kvs [][2]string) string {
+	var parts []string
+	for _, kv := range kvs {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+"="+kv[1])
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// projectCluster returns the entry of the cluster of the metadata in the clusters of the project description
+func projectCluster(m *storagev1.ProjectMetadata) string {
+	if m == nil || m.ClusterName == "" {
+		return ""
+	}
+	if m.Seed == "" {
+		return m.ClusterName
+	}
+	return m.ClusterName + "@" + m.Seed
+}
+
+// descriptionClusters returns the clusters listed in the given project description
+func descriptionClusters(description string) []string {
+	var clusters []string
+	for kv := range strings.SplitSeq(description, ",") {
+		value, ok := strings.CutPrefix(kv, "clusters=")
+		if !ok {
+			continue
+		}
+		for cluster := range strings.SplitSeq(value, "|") {
+			if cluster != "" && !slices.Contains(clusters, cluster) {
+				clusters = append(clusters, cluster)
+			}
+		}
+	}
+	slices.Sort(clusters)
+	return clusters
+}
+
+func (r *DurosReconciler) createProjectCredentialsIfNotExist(ctx context.Context, duros *storagev1.Duros, b *Backend, projectID string) (*durosv2.Credential, error) {
 	id := "root"
-	cred, err := r.DurosClient.GetCredential(ctx, &durosv2.GetCredentialRequest{ID: id, ProjectName: projectID})
+	cred, err := b.Client.GetCredential(ctx, &durosv2.GetCredentialRequest{ID: id, ProjectName: projectID})
 	if err != nil {
 		s, ok := status.FromError(err)
 		if !ok {
@@ -48,7 +207,7 @@ func (r *DurosReconciler) createProjectCredentialsIfNotExist(ctx context.Context
 		// FIXME is InvalidArgument a good idea here
 		case codes.NotFound, codes.InvalidArgument:
 			// create credential
-			key, err := extract(adminKey)
+			key, err := extract(b.AdminKey)
 			if err != nil {
 				return nil, err
 			}
@@ -68,7 +227,7 @@ func (r *DurosReconciler) createProjectCredentialsIfNotExist(ctx context.Context
 			// sign a single JWT using the priv key and deploy it into your customer's K8s cluster as a secret.
 			// so the Payload above is the PEM-encoded public key, not the JWT.
 			// you'll get a much more sensible docs bundle with the release, of course, this is just a preview.
-			cred, err = r.DurosClient.CreateCredential(ctx, &durosv2.CreateCredentialRequest{
+			cred, err = b.Client.CreateCredential(ctx, &durosv2.CreateCredentialRequest{
 				ProjectName: projectID,
 				ID:          id,
 				Type:        durosv2.CredsType_RS256PubKey,
@@ -77,6 +236,7 @@ func (r *DurosReconciler) createProjectCredentialsIfNotExist(ctx context.Context
 			if err != nil {
 				return nil, err
 			}
+			r.Recorder.Eventf(duros, corev1.EventTypeNormal, "CredentialCreated", "created credential %s of project %s in backend %s", id, projectID, b.Name)
 			return cred, nil
 		default:
 			return nil, err
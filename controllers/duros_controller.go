@@ -19,20 +19,33 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
 	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
 
 	duroscontrollerv1 "github.com/metal-stack/duros-controller/api/v1"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -43,24 +56,57 @@ const (
 // DurosReconciler reconciles a Duros object
 type DurosReconciler struct {
 	client.Client
-	Shoot       client.Client
+	Shoot client.Client
+	// ShootReader reads from the shoot apiserver without a cache, it is used for lists with field selectors
+	ShootReader client.Reader
 	Log         logr.Logger
 	Namespace   string
-	DurosClient durosv2.DurosAPIClient
-	Endpoints   string
-	AdminKey    []byte
+	// Backends are the lightos clusters by name, the DefaultBackend must be present
+	Backends map[string]*Backend
+	// Recorder records events on the duros resource in the seed
+	Recorder record.EventRecorder
+	// ShootRecorder records events on resources in the shoot
+	ShootRecorder record.EventRecorder
+	// OrphanCleanup enables the deletion of orphaned volumes after the OrphanGracePeriod
+	OrphanCleanup     bool
+	OrphanGracePeriod time.Duration
+	// ShootDiscovery provides the kubernetes version of the shoot
+	ShootDiscovery discovery.ServerVersionInterface
+	// VolumeLabelKeys are the label keys of persistent volume claims which are shown with their volumes in the status
+	VolumeLabelKeys []string
+	// VolumeHealthMonitor deploys the csi external-health-monitor-controller which reports abnormal volumes as events on their claims
+	VolumeHealthMonitor bool
+	// PrometheusRule deploys alerts with these thresholds into the namespace of the controller, nil disables the alerts
+	PrometheusRule *AlertThresholds
+	// PrometheusRuleLabels are set on the PrometheusRule, e.g. to match the rule selector of the prometheus in the seed
+	PrometheusRuleLabels map[string]string
+
+	// prometheusRuleDeleted is set once the PrometheusRule was deleted because the alerts are disabled
+	prometheusRuleDeleted atomic.Bool
+
+	// usedVolumes are the uuids of the volumes used by persistent volumes of the shoot in the last reconciliation,
+	// a volume which is not used anymore in the next reconciliation is owned by the shoot
+	usedVolumes   map[types.NamespacedName]map[string]bool
+	usedVolumesMu sync.Mutex
 }
 
 // Reconcile the Duros CRD
 // +kubebuilder:rbac:groups=storage.metal-stack.io,resources=duros,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=storage.metal-stack.io,resources=duros/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=storage.metal-stack.io,resources=snapshotschedules;snapshotschedules/status,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots;volumesnapshotclasses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=groupsnapshot.storage.k8s.io,resources=volumegroupsnapshotclasses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules;servicemonitors,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=storage.k8s.io,resources=csidrivers;csinodes;volumeattachments;storageclasses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=csidrivers;csinodes;csistoragecapacities;volumeattachments;storageclasses;volumeattributesclasses,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles;clusterrolebindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingadmissionpolicies;validatingadmissionpolicybindings,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:apps:groups=policy,resources=statefulsets;daemonsets,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:apps:groups="",resources=configmaps;events;secrets;serviceaccounts;nodes;persistentvolumes;persistentvolumeclaims;persistentvolumeclaims/status;pods,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:apps:groups="",resources=configmaps;events;secrets;services;serviceaccounts;nodes;persistentvolumes;persistentvolumeclaims;persistentvolumeclaims/status;pods,verbs=get;list;watch;create;update;patch;delete
 func (r *DurosReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("duros", req.NamespacedName)
+	ctx, span := tracer.Start(ctx, "Reconcile", trace.WithAttributes(attribute.String("duros", req.String())))
+	defer span.End()
 	requeue := ctrl.Result{
 		RequeueAfter: time.Second * 10,
 	}
@@ -75,16 +121,32 @@ func (r *DurosReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	if err := r.Get(ctx, req.NamespacedName, duros); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Info("no duros storage defined")
+			deleteDurosMetrics(req.Namespace)
 			return ctrl.Result{}, nil
 		}
 		return requeue, err
 	}
 
 	if duros.GetDeletionTimestamp() != nil && !duros.GetDeletionTimestamp().IsZero() {
-		log.Info("deletion timestamp is set, not doing anything, Gardener will do the cleanup")
+		log.Info("deletion timestamp is set, Gardener will do the cleanup")
+		deleteDurosMetrics(req.Namespace)
+		if controllerutil.ContainsFinalizer(duros, DurosFinalizerName) {
+			r.removeProjectCluster(ctx, duros)
+			controllerutil.RemoveFinalizer(duros, DurosFinalizerName)
+			if err := r.Update(ctx, duros); err != nil {
+				return requeue, err
+			}
+		}
 		return ctrl.Result{}, nil
 	}
 
+	// the finalizer removes the cluster from the project description when the duros resource is deleted
+	if projectCluster(duros.Spec.ProjectMetadata) != "" && controllerutil.AddFinalizer(duros, DurosFinalizerName) {
+		if err := r.Update(ctx, duros); err != nil {
+			return requeue, err
+		}
+	}
+
 	var err error
 
 	defer func() {
@@ -98,44 +160,170 @@ func (r *DurosReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		if err != nil {
 			msg := err.Error()
 			duros.Status.ReconcileStatus.Error = &msg
+			r.Recorder.Event(duros, corev1.EventTypeWarning, "ReconcileFailed", msg)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, msg)
 		}
 
-		r.setManagedResourceStatus(ctx, duros)
+		stepCtx, done := startStep(ctx, "status")
+		r.setManagedResourceStatus(stepCtx, duros)
 
-		if err := r.Status().Update(ctx, duros); err != nil {
-			log.Error(err, "error updating status of duros resource", "name", duros.Name)
+		updateErr := r.Status().Update(stepCtx, duros)
+		done(updateErr)
+		if updateErr != nil {
+			log.Error(updateErr, "error updating status of duros resource", "name", duros.Name)
 			return
 		}
 
 		r.Log.Info("status updated", "name", duros.Name)
 	}()
 
+	// alerts are deployed first, they must be present when the other steps fail
+	stepCtx, done := startStep(ctx, "alerts")
+	err = r.reconcilePrometheusRule(stepCtx)
+	done(err)
+	if err != nil {
+		return requeue, err
+	}
+
 	err = validateDuros(duros)
 	if err != nil {
 		return requeue, err
 	}
 
+	// invalid storage classes are not deployed, claims of them could not be provisioned
+	validStorageClasses := r.validateReplicas(duros)
+
 	projectID := duros.Spec.MetalProjectID
 	storageClasses := duros.Spec.StorageClasses
 
-	p, err := r.createProjectIfNotExist(ctx, projectID)
+	backends, err := r.usedBackends(storageClasses, duros.Spec.SnapshotClasses)
+	if err != nil {
+		return requeue, err
+	}
+	r.reconcileBackendsStatus(duros, backends)
+
+	for _, b := range backends {
+		log := log.WithValues("backend", b.Name)
+
+		var p *durosv2.Project
+		stepCtx, done := startStep(ctx, "project")
+		p, err = r.createProjectIfNotExist(stepCtx, duros, b, projectID)
+		done(err)
+		if err != nil {
+			return requeue, err
+		}
+		log.Info("created project", "name", p.GetName())
+
+		var cred *durosv2.Credential
+		stepCtx, done = startStep(ctx, "credential")
+		cred, err = r.createProjectCredentialsIfNotExist(stepCtx, duros, b, projectID)
+		done(err)
+		if err != nil {
+			return requeue, err
+		}
+		log.Info("created credential", "id", cred.GetID(), "project", cred.GetProjectName())
+
+		stepCtx, done = startStep(ctx, "secret")
+		err = r.reconcileStorageClassSecret(stepCtx, duros, b, cred)
+		done(err)
+		if err != nil {
+			return requeue, err
+		}
+
+		if b.mgmtEndpoints() == "" {
+			err = fmt.Errorf("no duros endpoints discovered yet for backend %s", b.Name)
+			return requeue, err
+		}
+	}
+
+	var (
+		images   imageSet
+		features features
+	)
+	_, done = startStep(ctx, "images")
+	images, features, err = r.selectImages(duros, backends)
+	done(err)
+	if err != nil {
+		return requeue, err
+	}
+
+	stepCtx, done = startStep(ctx, "csi")
+	err = r.deployCSI(stepCtx, duros, projectID, validStorageClasses, duros.Spec.SnapshotClasses, duros.Spec.VolumeAttributesClasses, images, features)
+	done(err)
+	if err != nil {
+		return requeue, err
+	}
+
+	// the csidriver enables the storage capacity tracking, the capacities are published right after it to not block the
+	// scheduling of claims if a later step fails. The quota is limited by the usage of the last reconciliation.
+	var lastQuota *duroscontrollerv1.QuotaStatus
+	if duros.Spec.Quota != nil {
+		lastQuota = duros.Status.Quota
+	}
+	stepCtx, done = startStep(ctx, "capacity")
+	err = r.reconcileStorageCapacities(stepCtx, validStorageClasses, lastQuota)
+	done(err)
+	if err != nil {
+		return requeue, err
+	}
+
+	var (
+		volumes      []projectVolumes
+		shootVolumes shootVolumes
+		claims       []corev1.PersistentVolumeClaim
+	)
+	stepCtx, done = startStep(ctx, "volumes")
+	volumes, err = r.listProjectVolumes(stepCtx, backends, projectID)
+	if err == nil {
+		shootVolumes, claims, err = r.listShootVolumes(stepCtx)
+	}
+	done(err)
+	if err != nil {
+		return requeue, err
+	}
+	setBackendVolumes(duros, volumes)
+
+	stepCtx, done = startStep(ctx, "imports")
+	err = r.reconcileVolumeImports(stepCtx, duros, volumes, shootVolumes, claims)
+	done(err)
+	if err != nil {
+		return requeue, err
+	}
+
+	duros.Status.Volumes = volumesStatus(volumes)
+	stepCtx, done = startStep(ctx, "claims")
+	err = r.reconcileVolumeClaims(stepCtx, duros, volumes, shootVolumes, claims)
+	done(err)
 	if err != nil {
 		return requeue, err
 	}
-	log.Info("created project", "name", p.GetName())
 
-	cred, err := r.createProjectCredentialsIfNotExist(ctx, projectID, r.AdminKey)
+	stepCtx, done = startStep(ctx, "provisioning")
+	err = r.setProvisioningFailures(stepCtx, duros, claims)
+	done(err)
 	if err != nil {
 		return requeue, err
 	}
-	log.Info("created credential", "id", cred.GetID(), "project", cred.GetProjectName())
 
-	err = r.reconcileStorageClassSecret(ctx, cred, r.AdminKey)
+	stepCtx, done = startStep(ctx, "orphans")
+	err = r.reconcileOrphanedVolumes(stepCtx, duros, volumes, shootVolumes)
+	done(err)
 	if err != nil {
 		return requeue, err
 	}
 
-	err = r.deployCSI(ctx, projectID, storageClasses)
+	duros.Status.Quota = nil
+	if duros.Spec.Quota != nil {
+		duros.Status.Quota = quotaStatus(duros.Spec.Quota, volumes)
+		if len(duros.Status.Quota.Exceeded) > 0 {
+			log.Info("project exceeds its quota", "exceeded", duros.Status.Quota.Exceeded)
+		}
+	}
+
+	stepCtx, done = startStep(ctx, "quota")
+	err = r.reconcileQuotaPolicy(stepCtx, duros)
+	done(err)
 	if err != nil {
 		return requeue, err
 	}
@@ -206,6 +394,10 @@ func (r *DurosReconciler) setManagedResourceStatus(ctx context.Context, duros *d
 	}
 
 	duros.Status.ManagedResourceStatuses = []duroscontrollerv1.ManagedResourceStatus{dsStatus, stsStatus}
+
+	// the names of the statuses are empty if the resources do not exist
+	setManagedResourceHealth(duros.Namespace, "DaemonSet", lbCSINodeName, dsStatus.State)
+	setManagedResourceHealth(duros.Namespace, "StatefulSet", lbCSIControllerName, stsStatus.State)
 }
 
 // SetupWithManager boilerplate to setup the Reconciler
@@ -232,5 +424,83 @@ func validateDuros(duros *duroscontrollerv1.Duros) error {
 			return fmt.Errorf("storageclass.replicacount must be greater than 0")
 		}
 	}
+	defaults := 0
+	for _, sc := range duros.Spec.SnapshotClasses {
+		if len(sc.Name) == 0 {
+			return fmt.Errorf("snapshotclass.name is empty")
+		}
+		switch sc.DeletionPolicy {
+		case "", string(snapshotv1.VolumeSnapshotContentDelete), string(snapshotv1.VolumeSnapshotContentRetain):
+		default:
+			return fmt.Errorf("snapshotclass.deletionpolicy of %s must be Delete or Retain", sc.Name)
+		}
+		if sc.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("only one snapshotclass can be the default")
+	}
+	for _, vac := range duros.Spec.VolumeAttributesClasses {
+		if len(vac.Name) == 0 {
+			return fmt.Errorf("volumeattributesclass.name is empty")
+		}
+		if len(vac.QoSPolicyName) == 0 {
+			return fmt.Errorf("volumeattributesclass.qospolicyname of %s is empty", vac.Name)
+		}
+	}
 	return nil
 }
+
+// validateReplicas sets the StorageClassesReady condition, it is false if a storage class requests more replicas
+// than its backend has servers, volumes of such a storage class can not be provisioned. It returns the storage classes
+// which are not invalid, classes of backends which were not polled yet are contained.
+func (r *DurosReconciler) validateReplicas(duros *duroscontrollerv1.Duros) []duroscontrollerv1.StorageClass {
+	condition := metav1.Condition{
+		Type:               duroscontrollerv1.ConditionStorageClassesReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Valid",
+		Message:            "all storageclasses are valid",
+		ObservedGeneration: duros.Generation,
+	}
+
+	var (
+		valid            []duroscontrollerv1.StorageClass
+		invalid, unknown []string
+	)
+	for _, sc := range duros.Spec.StorageClasses {
+		b, err := r.backend(sc.Backend)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %s", sc.Name, err))
+			continue
+		}
+		if b.HealthMonitor == nil {
+			valid = append(valid, sc)
+			continue
+		}
+		status := b.HealthMonitor.Status()
+		if status == nil || status.MaxReplicas == 0 {
+			// the cluster info was not polled yet, validated on the next reconciliation
+			unknown = append(unknown, sc.Name)
+			valid = append(valid, sc)
+			continue
+		}
+		if sc.ReplicaCount > status.MaxReplicas {
+			invalid = append(invalid, fmt.Sprintf("%s: %d replicas requested but backend %s allows at most %d replicas", sc.Name, sc.ReplicaCount, b.Name, status.MaxReplicas))
+			continue
+		}
+		valid = append(valid, sc)
+	}
+	switch {
+	case len(invalid) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "InvalidReplicas"
+		condition.Message = strings.Join(invalid, "; ")
+	case len(unknown) > 0:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "BackendNotPolled"
+		condition.Message = fmt.Sprintf("the maximum replicas of the backends of %s are not known yet", strings.Join(unknown, ", "))
+	}
+	meta.SetStatusCondition(&duros.Status.Conditions, condition)
+	return valid
+}
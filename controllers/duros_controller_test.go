@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestValidateReplicas(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     *storagev1.BackendStatus
+		replicas   int
+		wantStatus metav1.ConditionStatus
+		wantValid  []string
+	}{
+		{
+			name:       "not polled yet",
+			replicas:   3,
+			wantStatus: metav1.ConditionUnknown,
+			wantValid:  []string{"partition", "single"},
+		},
+		{
+			name:       "cluster info not polled yet",
+			status:     &storagev1.BackendStatus{Servers: 3},
+			replicas:   3,
+			wantStatus: metav1.ConditionUnknown,
+			wantValid:  []string{"partition", "single"},
+		},
+		{
+			name:       "within max replicas",
+			status:     &storagev1.BackendStatus{Servers: 3, MaxReplicas: 3},
+			replicas:   3,
+			wantStatus: metav1.ConditionTrue,
+			wantValid:  []string{"partition", "single"},
+		},
+		{
+			name:       "more replicas than currently possible",
+			status:     &storagev1.BackendStatus{Servers: 3, MaxReplicas: 2},
+			replicas:   3,
+			wantStatus: metav1.ConditionFalse,
+			wantValid:  []string{"single"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &DurosReconciler{
+				Backends: map[string]*Backend{
+					DefaultBackend: {Name: DefaultBackend, HealthMonitor: &HealthMonitor{status: tt.status}},
+				},
+			}
+			duros := &storagev1.Duros{
+				Spec: storagev1.DurosSpec{StorageClasses: []storagev1.StorageClass{
+					{Name: "partition", ReplicaCount: tt.replicas},
+					{Name: "single", ReplicaCount: 1},
+				}},
+			}
+
+			valid := r.validateReplicas(duros)
+
+			c := meta.FindStatusCondition(duros.Status.Conditions, storagev1.ConditionStorageClassesReady)
+			if c == nil || c.Status != tt.wantStatus {
+				t.Errorf("condition = %v, want status %s", c, tt.wantStatus)
+			}
+			var names []string
+			for _, sc := range valid {
+				names = append(names, sc.Name)
+			}
+			if !slices.Equal(names, tt.wantValid) {
+				t.Errorf("valid storage classes = %v, want %v", names, tt.wantValid)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestProjectDescription(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata *storagev1.ProjectMetadata
+		current  string
+		want     string
+	}{
+		{
+			name: "no metadata",
+			want: "",
+		},
+		{
+			name:     "metal project only",
+			metadata: &storagev1.ProjectMetadata{Tenant: "acme", ProjectName: "storage-test", Partition: "fra-equ01"},
+			want:     "tenant=acme,project=storage-test,partition=fra-equ01",
+		},
+		{
+			name:     "new project",
+			metadata: &storagev1.ProjectMetadata{Tenant: "acme", ClusterName: "shoot--storage--a", Seed: "seed-1"},
+			want:     "tenant=acme,clusters=shoot--storage--a@seed-1",
+		},
+		{
+			name:     "cluster without seed",
+			metadata: &storagev1.ProjectMetadata{ClusterName: "shoot--storage--a"},
+			want:     "clusters=shoot--storage--a",
+		},
+		{
+			name:     "clusters of other controllers are kept",
+			metadata: &storagev1.ProjectMetadata{Tenant: "acme", ClusterName: "shoot--storage--b", Seed: "seed-2"},
+			current:  "tenant=acme,clusters=shoot--storage--c@seed-1|shoot--storage--a@seed-1",
+			want:     "tenant=acme,clusters=shoot--storage--a@seed-1|shoot--storage--b@seed-2|shoot--storage--c@seed-1",
+		},
+		{
+			name:     "cluster already listed",
+			metadata: &storagev1.ProjectMetadata{Tenant: "acme", ClusterName: "shoot--storage--a", Seed: "seed-1"},
+			current:  "tenant=acme,clusters=shoot--storage--a@seed-1|shoot--storage--b@seed-2",
+			want:     "tenant=acme,clusters=shoot--storage--a@seed-1|shoot--storage--b@seed-2",
+		},
+		{
+			name:     "cluster migrated to another seed",
+			metadata: &storagev1.ProjectMetadata{Tenant: "acme", ClusterName: "shoot--storage--a", Seed: "seed-2"},
+			current:  "tenant=acme,clusters=shoot--storage--a@seed-1|shoot--storage--b@seed-1",
+			want:     "tenant=acme,clusters=shoot--storage--a@seed-2|shoot--storage--b@seed-1",
+		},
+		{
+			name:     "changed metal metadata",
+			metadata: &storagev1.ProjectMetadata{Tenant: "acme", ProjectName: "renamed", ClusterName: "shoot--storage--a", Seed: "seed-1"},
+			current:  "tenant=acme,project=storage-test,clusters=shoot--storage--a@seed-1",
+			want:     "tenant=acme,project=renamed,clusters=shoot--storage--a@seed-1",
+		},
+		{
+			name:     "free text description",
+			metadata: &storagev1.ProjectMetadata{Tenant: "acme"},
+			current:  "created by hand",
+			want:     "tenant=acme",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := projectDescription(tt.metadata, tt.current); got != tt.want {
+				t.Errorf("projectDescription() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescriptionWithoutCluster(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		cluster     string
+		want        string
+	}{
+		{
+			name:        "cluster is removed",
+			description: "tenant=acme,project=storage-test,clusters=shoot--storage--a@seed-1|shoot--storage--b@seed-2",
+			cluster:     "shoot--storage--a@seed-1",
+			want:        "tenant=acme,project=storage-test,clusters=shoot--storage--b@seed-2",
+		},
+		{
+			name:        "last cluster is removed",
+			description: "tenant=acme,clusters=shoot--storage--a@seed-1",
+			cluster:     "shoot--storage--a@seed-1",
+			want:        "tenant=acme",
+		},
+		{
+			name:        "entry of the migrated cluster in the new seed is kept",
+			description: "tenant=acme,clusters=shoot--storage--a@seed-2",
+			cluster:     "shoot--storage--a@seed-1",
+			want:        "tenant=acme,clusters=shoot--storage--a@seed-2",
+		},
+		{
+			name:        "cluster not listed",
+			description: "tenant=acme,clusters=shoot--storage--b@seed-2",
+			cluster:     "shoot--storage--a@seed-1",
+			want:        "tenant=acme,clusters=shoot--storage--b@seed-2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := descriptionWithoutCluster(tt.description, tt.cluster); got != tt.want {
+				t.Errorf("descriptionWithoutCluster() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateProjectDescription(t *testing.T) {
+	metadata := &storagev1.ProjectMetadata{Tenant: "acme", ClusterName: "shoot--storage--a", Seed: "seed-1"}
+
+	tests := []struct {
+		name    string
+		current string
+		// concurrent is written by the controller of another cluster right after the given update
+		concurrent  map[int]string
+		want        string
+		wantUpdates int
+	}{
+		{
+			name:        "description is up to date",
+			current:     "tenant=acme,clusters=shoot--storage--a@seed-1",
+			want:        "tenant=acme,clusters=shoot--storage--a@seed-1",
+			wantUpdates: 0,
+		},
+		{
+			name:        "cluster is added",
+			current:     "tenant=acme,clusters=shoot--storage--b@seed-1",
+			want:        "tenant=acme,clusters=shoot--storage--a@seed-1|shoot--storage--b@seed-1",
+			wantUpdates: 1,
+		},
+		{
+			name:        "concurrent update of another cluster is retried",
+			current:     "tenant=acme",
+			concurrent:  map[int]string{1: "tenant=acme,clusters=shoot--storage--b@seed-1"},
+			want:        "tenant=acme,clusters=shoot--storage--a@seed-1|shoot--storage--b@seed-1",
+			wantUpdates: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				description = tt.current
+				updates     int
+			)
+			b := &Backend{Name: DefaultBackend, Client: &fakeDurosClient{
+				getProject: func() (*durosv2.Project, error) {
+					return &durosv2.Project{Name: "project", Description: description}, nil
+				},
+				updateProject: func(d string) error {
+					updates++
+					description = d
+					if c, ok := tt.concurrent[updates]; ok {
+						description = c
+					}
+					return nil
+				},
+			}}
+			r := &DurosReconciler{Log: logr.Discard()}
+
+			p, err := r.updateProjectDescription(context.Background(), b, &durosv2.Project{Name: "project", Description: tt.current}, func(current string) string {
+				return projectDescription(metadata, current)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.GetDescription() != tt.want || description != tt.want {
+				t.Errorf("description = %q, returned %q, want %q", description, p.GetDescription(), tt.want)
+			}
+			if updates != tt.wantUpdates {
+				t.Errorf("updates = %d, want %d", updates, tt.wantUpdates)
+			}
+		})
+	}
+}
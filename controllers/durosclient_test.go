@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+)
+
+// fakeDurosClient answers the duros api calls used by the controller with the configured functions,
+// calls to other methods panic on the embedded nil interface
+type fakeDurosClient struct {
+	durosv2.DurosAPIClient
+
+	getVersion     func() (*durosv2.GetVersionResponse, error)
+	getClusterInfo func() (*durosv2.Cluster, error)
+	getProject     func() (*durosv2.Project, error)
+	getCredential  func() (*durosv2.Credential, error)
+	updateProject  func(description string) error
+	listServers    func() (*durosv2.ListServersResponse, error)
+	deleteVolume   func(uuid string) error
+}
+
+func (f *fakeDurosClient) GetVersion(ctx context.Context, in *durosv2.GetVersionRequest, opts ...grpc.CallOption) (*durosv2.GetVersionResponse, error) {
+	return f.getVersion()
+}
+
+func (f *fakeDurosClient) GetClusterInfo(ctx context.Context, in *durosv2.GetClusterRequest, opts ...grpc.CallOption) (*durosv2.Cluster, error) {
+	return f.getClusterInfo()
+}
+
+func (f *fakeDurosClient) GetProject(ctx context.Context, in *durosv2.GetProjectRequest, opts ...grpc.CallOption) (*durosv2.Project, error) {
+	return f.getProject()
+}
+
+func (f *fakeDurosClient) UpdateProject(ctx context.Context, in *durosv2.UpdateProjectRequest, opts ...grpc.CallOption) (*durosv2.Project, error) {
+	return &durosv2.Project{Name: in.Name, Description: in.Description}, f.updateProject(in.Description)
+}
+
+func (f *fakeDurosClient) GetCredential(ctx context.Context, in *durosv2.GetCredentialRequest, opts ...grpc.CallOption) (*durosv2.Credential, error) {
+	return f.getCredential()
+}
+
+func (f *fakeDurosClient) ListServers(ctx context.Context, in *durosv2.ListServersRequest, opts ...grpc.CallOption) (*durosv2.ListServersResponse, error) {
+	return f.listServers()
+}
+
+func (f *fakeDurosClient) DeleteVolume(ctx context.Context, in *durosv2.DeleteVolumeRequest, opts ...grpc.CallOption) (*durosv2.DeleteVolumeResponse, error) {
+	return &durosv2.DeleteVolumeResponse{}, f.deleteVolume(in.UUID)
+}
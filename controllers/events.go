@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// RateLimitedRecorder records the same event on the same object at most once per interval,
+// the duros resource is reconciled every 30 seconds and would otherwise repeat its events on every reconciliation.
+type RateLimitedRecorder struct {
+	recorder record.EventRecorder
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// NewRateLimitedRecorder wraps the given recorder
+func NewRateLimitedRecorder(recorder record.EventRecorder, interval time.Duration) *RateLimitedRecorder {
+	return &RateLimitedRecorder{
+		recorder: recorder,
+		interval: interval,
+		last:     map[string]time.Time{},
+	}
+}
+
+func (r *RateLimitedRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if !r.allow(object, eventtype, reason, message) {
+		return
+	}
+	r.recorder.Event(object, eventtype, reason, message)
+}
+
+func (r *RateLimitedRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...any) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *RateLimitedRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...any) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if !r.allow(object, eventtype, reason, message) {
+		return
+	}
+	r.recorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+}
+
+// allow returns true if the event was not recorded within the interval
+func (r *RateLimitedRecorder) allow(object runtime.Object, eventtype, reason, message string) bool {
+	key := fmt.Sprintf("%s/%s/%s/%s", objectKey(object), eventtype, reason, message)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, t := range r.last {
+		if now.Sub(t) >= r.interval {
+			delete(r.last, k)
+		}
+	}
+	if _, ok := r.last[key]; ok {
+		return false
+	}
+	r.last[key] = now
+	return true
+}
+
+func objectKey(object runtime.Object) string {
+	m, err := meta.Accessor(object)
+	if err != nil {
+		return fmt.Sprintf("%T", object)
+	}
+	if m.GetUID() != "" {
+		return string(m.GetUID())
+	}
+	return m.GetNamespace() + "/" + m.GetName()
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestRateLimitedRecorderAllow(t *testing.T) {
+	a := &storagev1.Duros{ObjectMeta: metav1.ObjectMeta{Namespace: "shoot--p--a", Name: "shoot-default-storage", UID: "a"}}
+	b := &storagev1.Duros{ObjectMeta: metav1.ObjectMeta{Namespace: "shoot--p--b", Name: "shoot-default-storage", UID: "b"}}
+
+	type event struct {
+		object    runtime.Object
+		eventtype string
+		reason    string
+		message   string
+	}
+	tests := []struct {
+		name   string
+		events []event
+		// expire lets the interval pass before the last event
+		expire bool
+		want   []bool
+	}{
+		{
+			name:   "same event is recorded once",
+			events: []event{{a, corev1.EventTypeNormal, "TokenRenewed", "renewed"}, {a, corev1.EventTypeNormal, "TokenRenewed", "renewed"}},
+			want:   []bool{true, false},
+		},
+		{
+			name:   "different messages are recorded",
+			events: []event{{a, corev1.EventTypeWarning, "ReconcileFailed", "first"}, {a, corev1.EventTypeWarning, "ReconcileFailed", "second"}},
+			want:   []bool{true, true},
+		},
+		{
+			name:   "different reasons are recorded",
+			events: []event{{a, corev1.EventTypeNormal, "ProjectCreated", "created"}, {a, corev1.EventTypeNormal, "CredentialCreated", "created"}},
+			want:   []bool{true, true},
+		},
+		{
+			name:   "different objects are recorded",
+			events: []event{{a, corev1.EventTypeNormal, "TokenIssued", "issued"}, {b, corev1.EventTypeNormal, "TokenIssued", "issued"}},
+			want:   []bool{true, true},
+		},
+		{
+			name:   "same event is recorded again after the interval",
+			events: []event{{a, corev1.EventTypeNormal, "TokenRenewed", "renewed"}, {a, corev1.EventTypeNormal, "TokenRenewed", "renewed"}},
+			expire: true,
+			want:   []bool{true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRateLimitedRecorder(record.NewFakeRecorder(10), 10*time.Minute)
+			for i, e := range tt.events {
+				if tt.expire && i == len(tt.events)-1 {
+					r.mu.Lock()
+					for k := range r.last {
+						r.last[k] = r.last[k].Add(-r.interval)
+					}
+					r.mu.Unlock()
+				}
+				if got := r.allow(e.object, e.eventtype, e.reason, e.message); got != tt.want[i] {
+					t.Errorf("event %d: allow() = %t, want %t", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
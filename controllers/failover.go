@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+)
+
+const (
+	endpointProbeInterval = 30 * time.Second
+	endpointProbeTimeout  = 5 * time.Second
+)
+
+// FailoverEndpoint is a single connection to one of the duros api endpoints
+type FailoverEndpoint struct {
+	Endpoint string
+	Client   durosv2.DurosAPIClient
+}
+
+// FailoverClient is a duros api client which sends its calls to one of several duros api endpoints.
+// Calls go to the endpoint which answered last, if this endpoint is unavailable the next one in
+// the configured order is tried.
+// Methods which are not explicitly wrapped are always sent to the first endpoint.
+type FailoverClient struct {
+	durosv2.DurosAPIClient
+
+	log       logr.Logger
+	backend   string
+	endpoints []FailoverEndpoint
+
+	mu     sync.Mutex
+	active int
+}
+
+// NewFailoverClient creates a FailoverClient for the endpoints of the given backend, the order of the endpoints is the failover order
+func NewFailoverClient(log logr.Logger, backend string, endpoints []FailoverEndpoint) (*FailoverClient, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("at least one api endpoint is required")
+	}
+	for _, e := range endpoints {
+		endpointUp.WithLabelValues(backend, e.Endpoint).Set(1)
+	}
+	return &FailoverClient{
+		DurosAPIClient: endpoints[0].Client,
+		log:            log,
+		backend:        backend,
+		endpoints:      endpoints,
+	}, nil
+}
+
+// Start periodically probes all endpoints to keep the health of the currently unused endpoints up to date
+func (f *FailoverClient) Start(ctx context.Context) error {
+	ticker := time.NewTicker(endpointProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			for _, e := range f.endpoints {
+				probeCtx, cancel := context.WithTimeout(ctx, endpointProbeTimeout)
+				_, err := e.Client.GetVersion(probeCtx, &durosv2.GetVersionRequest{})
+				cancel()
+				f.record(e.Endpoint, err)
+			}
+		}
+	}
+}
+
+// NeedLeaderElection returns false because endpoint health should be reported by every replica
+func (f *FailoverClient) NeedLeaderElection() bool {
+	return false
+}
+
+func (f *FailoverClient) GetVersion(ctx context.Context, in *durosv2.GetVersionRequest, opts ...grpc.CallOption) (*durosv2.GetVersionResponse, error) {
+	return failover(ctx, f, "GetVersion", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.GetVersionResponse, error) {
+		return c.GetVersion(ctx, in, opts...)
+	})
+}
+
+func (f *FailoverClient) GetClusterInfo(ctx context.Context, in *durosv2.GetClusterRequest, opts ...grpc.CallOption) (*durosv2.Cluster, error) {
+	return failover(ctx, f, "GetClusterInfo", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.Cluster, error) {
+		return c.GetClusterInfo(ctx, in, opts...)
+	})
+}
+
+func (f *FailoverClient) GetProject(ctx context.Context, in *durosv2.GetProjectRequest, opts ...grpc.CallOption) (*durosv2.Project, error) {
+	return failover(ctx, f, "GetProject", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.Project, error) {
+		return c.GetProject(ctx, in, opts...)
+	})
+}
+
+func (f *FailoverClient) CreateProject(ctx context.Context, in *durosv2.CreateProjectRequest, opts ...grpc.CallOption) (*durosv2.Project, error) {
+	return failover(ctx, f, "CreateProject", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.Project, error) {
+		return c.CreateProject(ctx, in, opts...)
+	})
+}
+
+func (f *FailoverClient) UpdateProject(ctx context.Context, in *durosv2.UpdateProjectRequest, opts ...grpc.CallOption) (*durosv2.Project, error) {
+	return failover(ctx, f, "UpdateProject", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.Project, error) {
+		return c.UpdateProject(ctx, in, opts...)
+	})
+}
+
+func (f *FailoverClient) GetCredential(ctx context.Context, in *durosv2.GetCredentialRequest, opts ...grpc.CallOption) (*durosv2.Credential, error) {
+	return failover(ctx, f, "GetCredential", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.Credential, error) {
+		return c.GetCredential(ctx, in, opts...)
+	})
+}
+
+func (f *FailoverClient) CreateCredential(ctx context.Context, in *durosv2.CreateCredentialRequest, opts ...grpc.CallOption) (*durosv2.Credential, error) {
+	return failover(ctx, f, "CreateCredential", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.Credential, error) {
+		return c.CreateCredential(ctx, in, opts...)
+	})
+}
+
+func (f *FailoverClient) ListVolumes(ctx context.Context, in *durosv2.ListVolumesRequest, opts ...grpc.CallOption) (*durosv2.ListVolumesResponse, error) {
+	return failover(ctx, f, "ListVolumes", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.ListVolumesResponse, error) {
+		return c.ListVolumes(ctx, in, opts...)
+	})
+}
+
+func (f *FailoverClient) DeleteVolume(ctx context.Context, in *durosv2.DeleteVolumeRequest, opts ...grpc.CallOption) (*durosv2.DeleteVolumeResponse, error) {
+	return failover(ctx, f, "DeleteVolume", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.DeleteVolumeResponse, error) {
+		return c.DeleteVolume(ctx, in, opts...)
+	})
+}
+
+func (f *FailoverClient) ListSnapshots(ctx context.Context, in *durosv2.ListSnapshotsRequest, opts ...grpc.CallOption) (*durosv2.ListSnapshotsResponse, error) {
+	return failover(ctx, f, "ListSnapshots", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.ListSnapshotsResponse, error) {
+		return c.ListSnapshots(ctx, in, opts...)
+	})
+}
+
+func (f *FailoverClient) ListServers(ctx context.Context, in *durosv2.ListServersRequest, opts ...grpc.CallOption) (*durosv2.ListServersResponse, error) {
+	return failover(ctx, f, "ListServers", func(ctx context.Context, c durosv2.DurosAPIClient) (*durosv2.ListServersResponse, error) {
+		return c.ListServers(ctx, in, opts...)
+	})
+}
+
+// failover calls fn with the active endpoint and switches to the next endpoint as long as the called endpoint is unavailable,
+// the duration of every call is recorded with the given method name.
+// The call is traced with a duros.<method> span and one duros.attempt child span per called endpoint, the trace context of the
+// attempt is sent in the grpc metadata. duros.Dial builds the grpc connection from its DialConfig (Endpoint, Scheme, Token,
+// ByteCredentials, Log, UserAgent) only and accepts no grpc.DialOption, so no stats handler can be installed on the connection
+// and the calls are traced here instead.
+func failover[T any](ctx context.Context, f *FailoverClient, method string, fn func(ctx context.Context, c durosv2.DurosAPIClient) (T, error)) (resp T, err error) {
+	ctx, span := tracer.Start(ctx, "duros."+method, trace.WithAttributes(attribute.String("rpc.method", method)))
+	defer func() {
+		span.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+		endSpan(span, err)
+	}()
+
+	f.mu.Lock()
+	start := f.active
+	f.mu.Unlock()
+
+	for i := range f.endpoints {
+		idx := (start + i) % len(f.endpoints)
+		e := f.endpoints[idx]
+
+		span.SetAttributes(attribute.String("duros.endpoint", e.Endpoint))
+		attemptCtx, attempt := tracer.Start(ctx, "duros.attempt", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			attribute.String("rpc.method", method),
+			attribute.String("duros.endpoint", e.Endpoint),
+			attribute.Int("duros.attempt", i+1),
+		))
+		callStart := time.Now()
+		resp, err = fn(injectTraceContext(attemptCtx), e.Client)
+		apiRequestDuration.WithLabelValues(method, f.backend, e.Endpoint, status.Code(err).String()).Observe(time.Since(callStart).Seconds())
+		attempt.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+		endSpan(attempt, err)
+		if ctx.Err() != nil {
+			// the caller gave up, this says nothing about the endpoint
+			return resp, err
+		}
+		f.record(e.Endpoint, err)
+		if isUnavailable(err) {
+			f.log.Error(err, "duros api endpoint unavailable, trying next endpoint", "endpoint", e.Endpoint)
+			endpointFailovers.WithLabelValues(f.backend, e.Endpoint).Inc()
+			span.AddEvent("failover", trace.WithAttributes(attribute.String("duros.endpoint", e.Endpoint)))
+			continue
+		}
+
+		if idx != start {
+			f.log.Info("switched duros api endpoint", "from", f.endpoints[start].Endpoint, "to", e.Endpoint)
+			f.mu.Lock()
+			f.active = idx
+			f.mu.Unlock()
+		}
+		return resp, err
+	}
+	return resp, err
+}
+
+func (f *FailoverClient) record(endpoint string, err error) {
+	if isUnavailable(err) {
+		endpointUp.WithLabelValues(f.backend, endpoint).Set(0)
+		return
+	}
+	endpointUp.WithLabelValues(f.backend, endpoint).Set(1)
+}
+
+// isUnavailable returns true if the error indicates that the endpoint itself could not be reached,
+// all other errors are answers of a working endpoint
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
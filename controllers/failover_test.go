@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+)
+
+func TestFailover(t *testing.T) {
+	var (
+		unavailable = status.Error(codes.Unavailable, "connection refused")
+		notFound    = status.Error(codes.NotFound, "not found")
+	)
+
+	tests := []struct {
+		name string
+		// errs are the errors of the endpoints a, b and c, nil answers with the name of the endpoint
+		errs   []error
+		active int
+		cancel bool
+
+		want         string
+		wantCode     codes.Code
+		wantCalled   []string
+		wantActive   int
+		wantAttempts int
+	}{
+		{
+			name:         "active endpoint answers",
+			errs:         []error{nil, nil, nil},
+			want:         "a",
+			wantCalled:   []string{"a"},
+			wantActive:   0,
+			wantAttempts: 1,
+		},
+		{
+			name:         "unavailable endpoint is skipped",
+			errs:         []error{unavailable, nil, nil},
+			want:         "b",
+			wantCalled:   []string{"a", "b"},
+			wantActive:   1,
+			wantAttempts: 2,
+		},
+		{
+			name:         "failover wraps around from the active endpoint",
+			errs:         []error{nil, nil, unavailable},
+			active:       2,
+			want:         "a",
+			wantCalled:   []string{"c", "a"},
+			wantActive:   0,
+			wantAttempts: 2,
+		},
+		{
+			name:         "other errors are answers of the endpoint",
+			errs:         []error{notFound, nil, nil},
+			wantCode:     codes.NotFound,
+			wantCalled:   []string{"a"},
+			wantActive:   0,
+			wantAttempts: 1,
+		},
+		{
+			name:         "all endpoints unavailable",
+			errs:         []error{unavailable, unavailable, unavailable},
+			active:       1,
+			wantCode:     codes.Unavailable,
+			wantCalled:   []string{"b", "c", "a"},
+			wantActive:   1,
+			wantAttempts: 3,
+		},
+		{
+			name:         "canceled call does not fail over",
+			errs:         []error{unavailable, nil, nil},
+			cancel:       true,
+			wantCode:     codes.Unavailable,
+			wantCalled:   []string{"a"},
+			wantActive:   0,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := recordSpans(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var (
+				called    []string
+				endpoints []FailoverEndpoint
+			)
+			for i, name := range []string{"a", "b", "c"} {
+				err := tt.errs[i]
+				endpoints = append(endpoints, FailoverEndpoint{Endpoint: name, Client: &fakeDurosClient{
+					getVersion: func() (*durosv2.GetVersionResponse, error) {
+						called = append(called, name)
+						if tt.cancel {
+							cancel()
+						}
+						if err != nil {
+							return nil, err
+						}
+						return &durosv2.GetVersionResponse{ApiVersion: name}, nil
+					},
+				}})
+			}
+			f, err := NewFailoverClient(logr.Discard(), "failover-test", endpoints)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.active = tt.active
+
+			resp, err := f.GetVersion(ctx, &durosv2.GetVersionRequest{})
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("GetVersion() code = %s, want %s", status.Code(err), tt.wantCode)
+			}
+			if err == nil && resp.GetApiVersion() != tt.want {
+				t.Errorf("GetVersion() answered by %s, want %s", resp.GetApiVersion(), tt.want)
+			}
+			if !slices.Equal(called, tt.wantCalled) {
+				t.Errorf("called endpoints = %v, want %v", called, tt.wantCalled)
+			}
+			if f.active != tt.wantActive {
+				t.Errorf("active endpoint = %d, want %d", f.active, tt.wantActive)
+			}
+
+			attempts := 0
+			for _, s := range spans.GetSpans() {
+				if s.Name == "duros.attempt" {
+					attempts++
+					if s.Parent.SpanID() != spanByName(t, spans, "duros.GetVersion").SpanContext.SpanID() {
+						t.Errorf("span duros.attempt is no child of duros.GetVersion")
+					}
+				}
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("duros.attempt spans = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+// HealthMonitor periodically polls the version, cluster info and servers of a lightos cluster
+type HealthMonitor struct {
+	Log      logr.Logger
+	Name     string
+	Client   durosv2.DurosAPIClient
+	Interval time.Duration
+
+	mu      sync.RWMutex
+	status  *storagev1.BackendStatus
+	cluster *durosv2.Cluster
+}
+
+// Start polls immediately and then in the configured interval until the context is done
+func (h *HealthMonitor) Start(ctx context.Context) error {
+	h.poll(ctx)
+
+	ticker := time.NewTicker(h.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			h.poll(ctx)
+		}
+	}
+}
+
+// NeedLeaderElection returns false, the health is needed by every replica
+func (h *HealthMonitor) NeedLeaderElection() bool {
+	return false
+}
+
+// Status returns the last polled health, nil if nothing was polled yet
+func (h *HealthMonitor) Status() *storagev1.BackendStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.status.DeepCopy()
+}
+
+// Cluster returns the last polled cluster info, nil if it was never polled successfully
+func (h *HealthMonitor) Cluster() *durosv2.Cluster {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.cluster
+}
+
+func (h *HealthMonitor) poll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	h.mu.RLock()
+	status := h.status.DeepCopy()
+	h.mu.RUnlock()
+	if status == nil {
+		status = &storagev1.BackendStatus{Name: h.Name}
+	}
+	status.LastUpdateTime = metav1.NewTime(time.Now())
+
+	cluster, err := h.check(ctx, status)
+	switch {
+	case err != nil && cluster == nil:
+		h.Log.Error(err, "backend is not reachable")
+		status.Healthy = false
+		status.State = storagev1.BackendStateUnreachable
+		status.Message = err.Error()
+	case err != nil:
+		h.Log.Error(err, "backend is not healthy")
+		status.Healthy = false
+		status.State = storagev1.BackendStateDegraded
+		status.Message = err.Error()
+	default:
+		status.Healthy = true
+		status.State = storagev1.BackendStateHealthy
+		status.Message = ""
+	}
+	setBackendState(h.Name, status.State)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = status
+	if cluster != nil {
+		h.cluster = cluster
+	}
+}
+
+// check updates the status with the current state of the cluster and returns an error if it is not healthy
+func (h *HealthMonitor) check(ctx context.Context, status *storagev1.BackendStatus) (*durosv2.Cluster, error) {
+	version, err := h.Client.GetVersion(ctx, &durosv2.GetVersionRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get version: %w", err)
+	}
+	status.APIVersion = version.GetApiVersion()
+
+	cluster, err := h.Client.GetClusterInfo(ctx, &durosv2.GetClusterRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get cluster info: %w", err)
+	}
+	status.MaxReplicas = int(cluster.GetCurrentMaxReplicas())
+
+	servers, err := h.Client.ListServers(ctx, &durosv2.ListServersRequest{})
+	if err != nil {
+		return cluster, fmt.Errorf("unable to list servers: %w", err)
+	}
+	var inactive []string
+	status.Servers = len(servers.GetServers())
+	status.ActiveServers = 0
+	for _, s := range servers.GetServers() {
+		if s.GetState() == durosv2.ServerState_Active {
+			status.ActiveServers++
+			continue
+		}
+		inactive = append(inactive, fmt.Sprintf("%s is %s", s.GetName(), s.GetState().String()))
+	}
+	if len(inactive) > 0 {
+		return cluster, fmt.Errorf("cluster is degraded: %s", strings.Join(inactive, ", "))
+	}
+	return cluster, nil
+}
+
+// reconcileBackendsStatus projects the health of the used backends into the status
+func (r *DurosReconciler) reconcileBackendsStatus(duros *storagev1.Duros, backends []*Backend) {
+	var (
+		statuses  []storagev1.BackendStatus
+		unhealthy []string
+		unknown   []string
+		// the volumes are counted later in the reconciliation, the counts of the last reconciliation are kept until then
+		previous = map[string]storagev1.BackendStatus{}
+	)
+	for _, s := range duros.Status.Backends {
+		previous[s.Name] = s
+	}
+	for _, b := range backends {
+		var status *storagev1.BackendStatus
+		if b.HealthMonitor != nil {
+			status = b.HealthMonitor.Status()
+		}
+		if status == nil {
+			unknown = append(unknown, b.Name)
+			continue
+		}
+		status.DegradedVolumes = previous[b.Name].DegradedVolumes
+		status.RebuildingVolumes = previous[b.Name].RebuildingVolumes
+		statuses = append(statuses, *status)
+		if !status.Healthy {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", b.Name, status.Message))
+		}
+	}
+	duros.Status.Backends = statuses
+
+	condition := metav1.Condition{
+		Type:               storagev1.ConditionBackendsHealthy,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Healthy",
+		Message:            "all backends are healthy",
+		ObservedGeneration: duros.Generation,
+	}
+	switch {
+	case len(unhealthy) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Degraded"
+		condition.Message = strings.Join(unhealthy, "; ")
+	case len(unknown) > 0:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "NotPolled"
+		condition.Message = "health of backends not polled yet: " + strings.Join(unknown, ", ")
+	}
+	meta.SetStatusCondition(&duros.Status.Conditions, condition)
+}
+
+// setBackendVolumes counts the degraded and rebuilding volumes of the project in every backend into the status of the backends
+func setBackendVolumes(duros *storagev1.Duros, pvs []projectVolumes) {
+	for _, pv := range pvs {
+		degraded, rebuilding := countUnprotectedVolumes(pv.volumes)
+		for i := range duros.Status.Backends {
+			if duros.Status.Backends[i].Name == pv.backend {
+				duros.Status.Backends[i].DegradedVolumes = degraded
+				duros.Status.Backends[i].RebuildingVolumes = rebuilding
+			}
+		}
+		backendVolumes.WithLabelValues(duros.Namespace, pv.backend, "degraded").Set(float64(degraded))
+		backendVolumes.WithLabelValues(duros.Namespace, pv.backend, "rebuilding").Set(float64(rebuilding))
+	}
+}
+
+// countUnprotectedVolumes returns the number of volumes which lost replicas and the number of volumes whose replicas are rebuilt
+func countUnprotectedVolumes(volumes []*durosv2.Volume) (degraded, rebuilding int) {
+	for _, v := range volumes {
+		switch v.GetProtectionState() {
+		case durosv2.ProtectionState_Degraded, durosv2.ProtectionState_ReadOnly, durosv2.ProtectionState_NotAvailable:
+			degraded++
+		}
+		// the rebuild progress is "None" if no replica is rebuilt
+		if p := v.GetRebuildProgress(); p != "" && p != "None" {
+			rebuilding++
+		}
+	}
+	return degraded, rebuilding
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestHealthMonitorPoll(t *testing.T) {
+	active := &durosv2.Server{Name: "server-0", State: durosv2.ServerState_Active}
+	inactive := &durosv2.Server{Name: "server-1"}
+
+	tests := []struct {
+		name        string
+		versionErr  error
+		servers     []*durosv2.Server
+		wantState   storagev1.BackendState
+		wantHealthy bool
+		wantActive  int
+	}{
+		{
+			name:        "all servers active",
+			servers:     []*durosv2.Server{active, active},
+			wantState:   storagev1.BackendStateHealthy,
+			wantHealthy: true,
+			wantActive:  2,
+		},
+		{
+			name:       "inactive server",
+			servers:    []*durosv2.Server{active, inactive},
+			wantState:  storagev1.BackendStateDegraded,
+			wantActive: 1,
+		},
+		{
+			name:       "api not reachable",
+			versionErr: status.Error(codes.Unavailable, "connection refused"),
+			wantState:  storagev1.BackendStateUnreachable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := "health-" + string(tt.wantState)
+			h := &HealthMonitor{
+				Log:  logr.Discard(),
+				Name: backend,
+				Client: &fakeDurosClient{
+					getVersion: func() (*durosv2.GetVersionResponse, error) {
+						if tt.versionErr != nil {
+							return nil, tt.versionErr
+						}
+						return &durosv2.GetVersionResponse{ApiVersion: "v2.3"}, nil
+					},
+					getClusterInfo: func() (*durosv2.Cluster, error) {
+						return &durosv2.Cluster{CurrentMaxReplicas: 2}, nil
+					},
+					listServers: func() (*durosv2.ListServersResponse, error) {
+						return &durosv2.ListServersResponse{Servers: tt.servers}, nil
+					},
+				},
+			}
+
+			h.poll(context.Background())
+
+			got := h.Status()
+			if got.State != tt.wantState || got.Healthy != tt.wantHealthy || got.ActiveServers != tt.wantActive {
+				t.Errorf("status = state %s healthy %t active %d, want state %s healthy %t active %d",
+					got.State, got.Healthy, got.ActiveServers, tt.wantState, tt.wantHealthy, tt.wantActive)
+			}
+			if v := testutil.ToFloat64(backendState.WithLabelValues(backend, string(tt.wantState))); v != 1 {
+				t.Errorf("backend_state{state=%q} = %v, want 1", tt.wantState, v)
+			}
+		})
+	}
+}
+
+func TestSetBackendVolumes(t *testing.T) {
+	duros := &storagev1.Duros{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shoot--p--health", Name: "shoot-default-storage"},
+		Status: storagev1.DurosStatus{
+			Backends: []storagev1.BackendStatus{{Name: DefaultBackend, DegradedVolumes: 5}, {Name: "capacity"}},
+		},
+	}
+	pvs := []projectVolumes{
+		{
+			backend: DefaultBackend,
+			volumes: []*durosv2.Volume{
+				{Name: "protected", ProtectionState: durosv2.ProtectionState_FullyProtected, RebuildProgress: "None"},
+				{Name: "degraded", ProtectionState: durosv2.ProtectionState_Degraded, RebuildProgress: "None"},
+				{Name: "rebuilding", ProtectionState: durosv2.ProtectionState_Degraded, RebuildProgress: "42%"},
+				{Name: "read-only", ProtectionState: durosv2.ProtectionState_ReadOnly},
+			},
+		},
+		{
+			backend: "capacity",
+			volumes: []*durosv2.Volume{
+				{Name: "protected", ProtectionState: durosv2.ProtectionState_FullyProtected},
+			},
+		},
+	}
+
+	setBackendVolumes(duros, pvs)
+
+	tests := []struct {
+		backend        string
+		wantDegraded   int
+		wantRebuilding int
+	}{
+		{backend: DefaultBackend, wantDegraded: 3, wantRebuilding: 1},
+		{backend: "capacity"},
+	}
+	for i, tt := range tests {
+		got := duros.Status.Backends[i]
+		if got.DegradedVolumes != tt.wantDegraded || got.RebuildingVolumes != tt.wantRebuilding {
+			t.Errorf("%s: degraded %d rebuilding %d, want degraded %d rebuilding %d", tt.backend, got.DegradedVolumes, got.RebuildingVolumes, tt.wantDegraded, tt.wantRebuilding)
+		}
+		if v := testutil.ToFloat64(backendVolumes.WithLabelValues(duros.Namespace, tt.backend, "degraded")); int(v) != tt.wantDegraded {
+			t.Errorf("%s: backend_volumes{state=\"degraded\"} = %v, want %d", tt.backend, v, tt.wantDegraded)
+		}
+	}
+}
+
+func TestReconcileBackendsStatusKeepsVolumeCounts(t *testing.T) {
+	h := &HealthMonitor{Name: DefaultBackend}
+	h.status = &storagev1.BackendStatus{Name: DefaultBackend, Healthy: true, State: storagev1.BackendStateHealthy}
+	r := &DurosReconciler{}
+	duros := &storagev1.Duros{Status: storagev1.DurosStatus{
+		Backends: []storagev1.BackendStatus{{Name: DefaultBackend, DegradedVolumes: 2, RebuildingVolumes: 1}},
+	}}
+
+	r.reconcileBackendsStatus(duros, []*Backend{{Name: DefaultBackend, HealthMonitor: h}})
+
+	got := duros.Status.Backends[0]
+	if got.State != storagev1.BackendStateHealthy || got.DegradedVolumes != 2 || got.RebuildingVolumes != 1 {
+		t.Errorf("backend status = %+v, want the polled state and the volume counts of the last reconciliation", got)
+	}
+}
@@ -1,12 +1,52 @@
 package controllers
 
 const (
+	// externalSnapshotterVersion is the release of the snapshot controller, the csi snapshotter and the embedded snapshot crds
+	externalSnapshotterVersion = "v8.5.0"
+
 	lbCSIPluginImage            = "docker.lightbitslabs.com/lightos-csi/lb-csi-plugin:v1.21.0"
 	lbDiscoveryClientImage      = "docker.lightbitslabs.com/lightos-csi/lb-nvme-discovery-client:v1.21.0"
 	csiProvisionerImage         = "registry.k8s.io/sig-storage/csi-provisioner:v5.3.0"
 	csiAttacherImage            = "registry.k8s.io/sig-storage/csi-attacher:v4.11.0"
 	csiResizerImage             = "registry.k8s.io/sig-storage/csi-resizer:v2.1.0"
 	csiNodeDriverRegistrarImage = "registry.k8s.io/sig-storage/csi-node-driver-registrar:v2.16.0"
-	snapshotControllerImage     = "registry.k8s.io/sig-storage/snapshot-controller:v8.5.0"
-	csiSnapshotterImage         = "registry.k8s.io/sig-storage/csi-snapshotter:v8.5.0"
+	snapshotControllerImage     = "registry.k8s.io/sig-storage/snapshot-controller:" + externalSnapshotterVersion
+	csiSnapshotterImage         = "registry.k8s.io/sig-storage/csi-snapshotter:" + externalSnapshotterVersion
+	livenessProbeImage          = "registry.k8s.io/sig-storage/livenessprobe:v2.17.0"
+	csiHealthMonitorImage       = "registry.k8s.io/sig-storage/csi-external-health-monitor-controller:v0.16.0"
 )
+
+// compatibilityMatrix lists the images which are known to work with a range of shoot kubernetes versions and
+// lightos api versions, the first entry which supports the shoot and all its backends is deployed.
+// The lightos api version of a backend is polled by its health monitor.
+// Ranges are inclusive, an empty bound is unlimited.
+var compatibilityMatrix = []compatibility{
+	{
+		// the v8 snapshotter requires the v1 snapshot api, the v5 provisioner requires csistoragecapacities in v1
+		kubernetes: versionRange{min: "1.25"},
+		// the lb-csi-plugin v1.21 talks to the v2 api of lightos
+		lightos: versionRange{min: "2", max: "2"},
+		images: imageSet{
+			lbCSIPlugin:            lbCSIPluginImage,
+			lbDiscoveryClient:      lbDiscoveryClientImage,
+			csiProvisioner:         csiProvisionerImage,
+			csiAttacher:            csiAttacherImage,
+			csiResizer:             csiResizerImage,
+			csiNodeDriverRegistrar: csiNodeDriverRegistrarImage,
+			snapshotController:     snapshotControllerImage,
+			csiSnapshotter:         csiSnapshotterImage,
+			livenessProbe:          livenessProbeImage,
+			csiHealthMonitor:       csiHealthMonitorImage,
+		},
+		// the v1beta2 group snapshot api is served by the embedded crds, it requires kubernetes 1.32 or newer.
+		// Group snapshots are only enabled for the plugin and lightos versions they were verified with,
+		// raise the bounds after verifying newer versions.
+		groupSnapshots: &featureSupport{
+			kubernetes: versionRange{min: "1.32"},
+			lightos:    versionRange{min: "2.3", max: "2"},
+			plugin:     versionRange{min: "1.21", max: "1.21"},
+		},
+		// the provisioner and resizer support ModifyVolume with the volumeattributesclass api of kubernetes 1.31 or newer
+		volumeAttributesClasses: &featureSupport{kubernetes: versionRange{min: "1.31"}},
+	},
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+const (
+	// importVolumeAnnotation on a persistent volume claim references an existing volume of the project by name or uuid,
+	// a persistent volume for this volume is created with the name given in spec.volumeName of the claim.
+	importVolumeAnnotation = "storage.metal-stack.io/import-volume"
+	// importFSTypeAnnotation on the claim sets the filesystem of the imported volume, it defaults to the fstype of the storage class
+	importFSTypeAnnotation = "storage.metal-stack.io/import-fstype"
+	// fsTypeParameter is the parameter of a storage class which sets the filesystem of its volumes
+	fsTypeParameter = "csi.storage.k8s.io/fstype"
+)
+
+// reconcileVolumeImports creates persistent volumes for existing volumes of the project which are requested by persistent volume claims.
+// The claim must set spec.volumeName, otherwise the csi provisioner would provision a new volume for it.
+func (r *DurosReconciler) reconcileVolumeImports(ctx context.Context, duros *storagev1.Duros, pvs []projectVolumes, shoot shootVolumes, claims []corev1.PersistentVolumeClaim) error {
+	log := r.Log.WithName("import")
+
+	for i := range claims {
+		claim := &claims[i]
+		ref, ok := claim.Annotations[importVolumeAnnotation]
+		if !ok || claim.Status.Phase != corev1.ClaimPending {
+			continue
+		}
+		log := log.WithValues("claim", claim.Namespace+"/"+claim.Name, "volume", ref)
+
+		if claim.Spec.VolumeName == "" {
+			r.ShootRecorder.Eventf(claim, corev1.EventTypeWarning, "VolumeImportFailed", "spec.volumeName must be set to the name of the persistent volume to create for volume %s", ref)
+			continue
+		}
+		err := r.Shoot.Get(ctx, types.NamespacedName{Name: claim.Spec.VolumeName}, &corev1.PersistentVolume{})
+		if err == nil {
+			// already imported, the claim is bound shortly
+			continue
+		}
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		fsType, err := r.importFSType(ctx, claim)
+		if err != nil {
+			return err
+		}
+
+		pv, err := r.importedPersistentVolume(duros, claim, ref, fsType, pvs, shoot)
+		if err != nil {
+			log.Error(err, "unable to import volume")
+			r.ShootRecorder.Eventf(claim, corev1.EventTypeWarning, "VolumeImportFailed", "unable to import volume %s: %s", ref, err)
+			continue
+		}
+
+		err = r.Shoot.Create(ctx, pv)
+		if err != nil {
+			return fmt.Errorf("unable to create persistent volume for imported volume %s: %w", ref, err)
+		}
+		// the imported volume is used by the shoot from now on
+		shoot.add(pv)
+		log.Info("imported volume", "persistentvolume", pv.Name)
+		r.ShootRecorder.Eventf(claim, corev1.EventTypeNormal, "VolumeImported", "created persistent volume %s for volume %s", pv.Name, ref)
+	}
+	return nil
+}
+
+// importFSType returns the filesystem of the volume imported by the claim. LightOS does not know the filesystem of a volume,
+// it is taken from the annotation of the claim, the fstype parameter of the storage class in the shoot or the default of the csi provisioner.
+// Block volumes have no filesystem.
+func (r *DurosReconciler) importFSType(ctx context.Context, claim *corev1.PersistentVolumeClaim) (string, error) {
+	if claim.Spec.VolumeMode != nil && *claim.Spec.VolumeMode == corev1.PersistentVolumeBlock {
+		return "", nil
+	}
+	if fsType := claim.Annotations[importFSTypeAnnotation]; fsType != "" {
+		return fsType, nil
+	}
+	if claim.Spec.StorageClassName != nil {
+		sc := &storage.StorageClass{}
+		err := r.Shoot.Get(ctx, types.NamespacedName{Name: *claim.Spec.StorageClassName}, sc)
+		if client.IgnoreNotFound(err) != nil {
+			return "", fmt.Errorf("unable to read storageclass %s: %w", *claim.Spec.StorageClassName, err)
+		}
+		if fsType := sc.Parameters[fsTypeParameter]; fsType != "" {
+			return fsType, nil
+		}
+	}
+	return defaultFSType, nil
+}
+
+// importedPersistentVolume renders the persistent volume with the given filesystem for the volume referenced by the claim
+func (r *DurosReconciler) importedPersistentVolume(duros *storagev1.Duros, claim *corev1.PersistentVolumeClaim, ref, fsType string, pvs []projectVolumes, shoot shootVolumes) (*corev1.PersistentVolume, error) {
+	if claim.Spec.StorageClassName == nil {
+		return nil, fmt.Errorf("spec.storageClassName must be set")
+	}
+	var sc *storagev1.StorageClass
+	for i := range duros.Spec.StorageClasses {
+		if duros.Spec.StorageClasses[i].Name == *claim.Spec.StorageClassName {
+			sc = &duros.Spec.StorageClasses[i]
+		}
+	}
+	if sc == nil {
+		return nil, fmt.Errorf("storageclass %s is not managed by duros-controller", *claim.Spec.StorageClassName)
+	}
+	if sc.Encryption {
+		return nil, fmt.Errorf("volumes of storageclass %s are encrypted, importing them is not supported", sc.Name)
+	}
+
+	b, err := r.backend(sc.Backend)
+	if err != nil {
+		return nil, err
+	}
+
+	var volume *durosv2.Volume
+	for _, pv := range pvs {
+		if pv.backend != b.Name {
+			continue
+		}
+		for _, v := range pv.volumes {
+			if v.GetUUID() == ref || v.GetName() == ref {
+				volume = v
+			}
+		}
+	}
+	if volume == nil {
+		return nil, fmt.Errorf("volume not found in project %s of backend %s", duros.Spec.MetalProjectID, b.Name)
+	}
+	if shoot.lookup(volume.GetUUID(), volume.GetName()) != nil {
+		return nil, fmt.Errorf("volume is already used by a persistent volume")
+	}
+	if isAttached(volume) {
+		return nil, fmt.Errorf("volume is attached, it must be detached before it can be imported")
+	}
+
+	size := resource.NewQuantity(int64(volume.GetSize()), resource.BinarySI) //nolint:gosec
+	if request, ok := claim.Spec.Resources.Requests[corev1.ResourceStorage]; ok && request.Cmp(*size) > 0 {
+		return nil, fmt.Errorf("claim requests %s but the volume has a size of %s", request.String(), size.String())
+	}
+
+	accessModes := claim.Spec.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+	secretRef := &corev1.SecretReference{Name: b.credentialsRef(), Namespace: namespace}
+
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: claim.Spec.VolumeName,
+			Annotations: map[string]string{
+				"pv.kubernetes.io/provisioned-by": provisioner,
+				importVolumeAnnotation:            volume.GetUUID(),
+				metalClusterDescriptionTag:        durosDoNotEditMessage,
+			},
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceStorage: *size,
+			},
+			AccessModes: accessModes,
+			// the volume existed before the cluster, it must not be deleted together with the claim
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			StorageClassName:              sc.Name,
+			VolumeMode:                    claim.Spec.VolumeMode,
+			ClaimRef: &corev1.ObjectReference{
+				Kind:       "PersistentVolumeClaim",
+				APIVersion: "v1",
+				Namespace:  claim.Namespace,
+				Name:       claim.Name,
+				UID:        claim.UID,
+			},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:                     provisioner,
+					VolumeHandle:               fmt.Sprintf("mgmt:%s|nguid:%s|proj:%s|scheme:grpcs", b.mgmtEndpoints(), volume.GetUUID(), duros.Spec.MetalProjectID),
+					FSType:                     fsType,
+					ControllerPublishSecretRef: secretRef,
+					ControllerExpandSecretRef:  secretRef,
+					NodeStageSecretRef:         secretRef,
+					NodePublishSecretRef:       secretRef,
+				},
+			},
+		},
+	}, nil
+}
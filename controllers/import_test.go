@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestReconcileVolumeImports(t *testing.T) {
+	duros := &storagev1.Duros{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shoot--p--import", Name: "shoot-default-storage"},
+		Spec: storagev1.DurosSpec{
+			MetalProjectID: "project",
+			StorageClasses: []storagev1.StorageClass{
+				{Name: "partition-silver", ReplicaCount: 1},
+				{Name: "partition-encrypted", ReplicaCount: 1, Encryption: true},
+			},
+		},
+	}
+	pvs := []projectVolumes{{
+		backend: DefaultBackend,
+		volumes: []*durosv2.Volume{
+			{UUID: "uuid-a", Name: "pvc-a", Size: 10 << 30},
+			{UUID: "uuid-used", Name: "pvc-used", Size: 10 << 30},
+			{UUID: "uuid-attached", Name: "pvc-attached", Size: 10 << 30, ACL: &durosv2.VolumeAcl{Values: []string{"nqn.2014-08.org.nvmexpress:uuid:node"}}},
+		},
+	}}
+	claim := func(ref string, modify ...func(c *corev1.PersistentVolumeClaim)) corev1.PersistentVolumeClaim {
+		c := corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "data", UID: "claim-uid", Annotations: map[string]string{importVolumeAnnotation: ref}},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: new("partition-silver"),
+				VolumeName:       "imported-data",
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+				},
+			},
+			Status: corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+		}
+		for _, m := range modify {
+			m(&c)
+		}
+		return c
+	}
+	existingPV := &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "imported-data"}}
+	usedPV := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-used"},
+		Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+			Driver:       provisioner,
+			VolumeHandle: "mgmt:10.0.0.1:443|nguid:uuid-used|proj:project|scheme:grpcs",
+		}}},
+	}
+
+	tests := []struct {
+		name   string
+		claim  corev1.PersistentVolumeClaim
+		shoot  []client.Object
+		wantFS string
+		// wantEvent is the prefix of the event recorded on the claim, empty if no event is recorded
+		wantEvent string
+		wantPV    bool
+	}{
+		{
+			name:      "volume is imported with the default fstype",
+			claim:     claim("pvc-a"),
+			wantPV:    true,
+			wantFS:    defaultFSType,
+			wantEvent: "Normal VolumeImported",
+		},
+		{
+			name:  "volume is imported by uuid with the fstype of the claim",
+			claim: claim("uuid-a", func(c *corev1.PersistentVolumeClaim) { c.Annotations[importFSTypeAnnotation] = "xfs" }),
+			shoot: []client.Object{
+				&storage.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "partition-silver"}, Parameters: map[string]string{fsTypeParameter: "ext3"}},
+			},
+			wantPV:    true,
+			wantFS:    "xfs",
+			wantEvent: "Normal VolumeImported",
+		},
+		{
+			name:  "volume is imported with the fstype of the storage class",
+			claim: claim("pvc-a"),
+			shoot: []client.Object{
+				&storage.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "partition-silver"}, Parameters: map[string]string{fsTypeParameter: "xfs"}},
+			},
+			wantPV:    true,
+			wantFS:    "xfs",
+			wantEvent: "Normal VolumeImported",
+		},
+		{
+			name:      "block volume has no fstype",
+			claim:     claim("pvc-a", func(c *corev1.PersistentVolumeClaim) { c.Spec.VolumeMode = new(corev1.PersistentVolumeBlock) }),
+			wantPV:    true,
+			wantFS:    "",
+			wantEvent: "Normal VolumeImported",
+		},
+		{
+			name:  "persistent volume already exists",
+			claim: claim("pvc-a"),
+			shoot: []client.Object{existingPV},
+		},
+		{
+			name:  "bound claim is skipped",
+			claim: claim("pvc-a", func(c *corev1.PersistentVolumeClaim) { c.Status.Phase = corev1.ClaimBound }),
+		},
+		{
+			name:      "volume not found",
+			claim:     claim("pvc-missing"),
+			wantEvent: "Warning VolumeImportFailed unable to import volume pvc-missing: volume not found",
+		},
+		{
+			name:      "volume used by another persistent volume",
+			claim:     claim("pvc-used"),
+			shoot:     []client.Object{usedPV},
+			wantEvent: "Warning VolumeImportFailed unable to import volume pvc-used: volume is already used",
+		},
+		{
+			name:      "attached volume",
+			claim:     claim("pvc-attached"),
+			wantEvent: "Warning VolumeImportFailed unable to import volume pvc-attached: volume is attached",
+		},
+		{
+			name:      "encrypted storage class",
+			claim:     claim("pvc-a", func(c *corev1.PersistentVolumeClaim) { c.Spec.StorageClassName = new("partition-encrypted") }),
+			wantEvent: "Warning VolumeImportFailed unable to import volume pvc-a: volumes of storageclass partition-encrypted are encrypted",
+		},
+		{
+			name: "claim larger than the volume",
+			claim: claim("pvc-a", func(c *corev1.PersistentVolumeClaim) {
+				c.Spec.Resources.Requests[corev1.ResourceStorage] = resource.MustParse("20Gi")
+			}),
+			wantEvent: "Warning VolumeImportFailed unable to import volume pvc-a: claim requests 20Gi",
+		},
+		{
+			name:      "volume name missing",
+			claim:     claim("pvc-a", func(c *corev1.PersistentVolumeClaim) { c.Spec.VolumeName = "" }),
+			wantEvent: "Warning VolumeImportFailed spec.volumeName must be set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &DurosReconciler{
+				Shoot:         newFakeClient(tt.shoot...),
+				Log:           logr.Discard(),
+				Backends:      map[string]*Backend{DefaultBackend: {Name: DefaultBackend, Endpoints: "10.0.0.1:443"}},
+				ShootRecorder: recorder,
+			}
+			shoot := shootVolumes{}
+			for _, obj := range tt.shoot {
+				if pv, ok := obj.(*corev1.PersistentVolume); ok {
+					shoot.add(pv)
+				}
+			}
+
+			err := r.reconcileVolumeImports(context.Background(), duros, pvs, shoot, []corev1.PersistentVolumeClaim{tt.claim})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pv := &corev1.PersistentVolume{}
+			err = r.Shoot.Get(context.Background(), types.NamespacedName{Name: "imported-data"}, pv)
+			switch {
+			case tt.wantPV && err != nil:
+				t.Fatalf("persistent volume not created: %v", err)
+			case tt.wantPV:
+				if pv.Spec.CSI.FSType != tt.wantFS {
+					t.Errorf("fstype = %q, want %q", pv.Spec.CSI.FSType, tt.wantFS)
+				}
+				if pv.Spec.ClaimRef == nil || pv.Spec.ClaimRef.UID != tt.claim.UID {
+					t.Errorf("persistent volume is not bound to the claim: %v", pv.Spec.ClaimRef)
+				}
+				if shoot.lookup("uuid-a", "pvc-a") == nil {
+					t.Errorf("imported volume is not added to the volumes of the shoot")
+				}
+			case err == nil && pv.Annotations[importVolumeAnnotation] != "":
+				t.Errorf("persistent volume created unexpectedly")
+			case err != nil && !apierrors.IsNotFound(err):
+				t.Fatal(err)
+			}
+
+			var event string
+			select {
+			case event = <-recorder.Events:
+			default:
+			}
+			if tt.wantEvent == "" && event != "" || !strings.HasPrefix(event, tt.wantEvent) {
+				t.Errorf("event = %q, want %q", event, tt.wantEvent)
+			}
+		})
+	}
+}
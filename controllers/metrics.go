@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+const metricsNamespace = "duros_controller"
+
+var (
+	endpointUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_endpoint_up",
+		Help:      "Whether the duros api endpoint was reachable on the last call, 1 means reachable.",
+	}, []string{"backend", "endpoint"})
+
+	endpointFailovers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_endpoint_failovers_total",
+		Help:      "Number of calls which were retried on another duros api endpoint because this endpoint was unavailable.",
+	}, []string{"backend", "endpoint"})
+
+	orphanedVolumes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "orphaned_volumes",
+		Help:      "Number of detached volumes of the project which are not used by any persistent volume of the shoot.",
+	}, []string{"backend"})
+
+	reconcileStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_step_duration_seconds",
+		Help:      "Duration of the steps of the duros reconciliation.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"step"})
+
+	reconcileStepErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_step_errors_total",
+		Help:      "Number of failed steps of the duros reconciliation.",
+	}, []string{"step"})
+
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Duration of the calls to the duros api by method, backend, endpoint and grpc status code.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"method", "backend", "endpoint", "code"})
+
+	tokenExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "storage_class_token_expiry_timestamp_seconds",
+		Help:      "Expiry time of the token in the storage class secret of the shoot as unix timestamp.",
+	}, []string{"namespace", "backend"})
+
+	managedResourceHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "managed_resource_healthy",
+		Help:      "Whether the managed resource in the shoot is running, 1 means running.",
+	}, []string{"namespace", "kind", "name"})
+
+	backendState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "backend_state",
+		Help:      "Health state of the lightos cluster, 1 for the current state and 0 for the others.",
+	}, []string{"backend", "state"})
+
+	backendVolumes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "backend_volumes",
+		Help:      "Number of volumes of the project in the lightos cluster which are degraded or whose replicas are rebuilt.",
+	}, []string{"namespace", "backend", "state"})
+
+	provisioningFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "provisioning_failures",
+		Help:      "Number of pending persistent volume claims of the managed storage classes in the shoot by the reason their provisioning failed.",
+	}, []string{"namespace", "reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		endpointUp,
+		endpointFailovers,
+		orphanedVolumes,
+		reconcileStepDuration,
+		reconcileStepErrors,
+		apiRequestDuration,
+		tokenExpiry,
+		managedResourceHealthy,
+		backendState,
+		backendVolumes,
+		provisioningFailures,
+	)
+}
+
+// observeReconcileStep records the duration of a reconcile step which started at start and counts its error
+func observeReconcileStep(step string, start time.Time, err error) {
+	reconcileStepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+	if err != nil {
+		reconcileStepErrors.WithLabelValues(step).Inc()
+	}
+}
+
+// setManagedResourceHealth records whether the managed resource is running
+func setManagedResourceHealth(namespace, kind, name string, state storagev1.HealthState) {
+	healthy := 0.0
+	if state == storagev1.HealthStateRunning {
+		healthy = 1
+	}
+	managedResourceHealthy.WithLabelValues(namespace, kind, name).Set(healthy)
+}
+
+// setBackendState records the health state of the backend
+func setBackendState(backend string, state storagev1.BackendState) {
+	for _, s := range []storagev1.BackendState{storagev1.BackendStateHealthy, storagev1.BackendStateDegraded, storagev1.BackendStateUnreachable} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		backendState.WithLabelValues(backend, string(s)).Set(value)
+	}
+}
+
+// deleteDurosMetrics removes the gauges of the duros resource in the given namespace, they would report the last state forever otherwise
+func deleteDurosMetrics(namespace string) {
+	for _, gauge := range []*prometheus.GaugeVec{tokenExpiry, managedResourceHealthy, backendVolumes, provisioningFailures} {
+		gauge.DeletePartialMatch(prometheus.Labels{"namespace": namespace})
+	}
+	// the orphaned volumes are not labelled with the namespace, the controller reconciles a single duros resource
+	orphanedVolumes.Reset()
+}
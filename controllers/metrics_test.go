@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestDeleteDurosMetrics(t *testing.T) {
+	const (
+		deleted = "shoot--metrics--deleted"
+		other   = "shoot--metrics--other"
+	)
+	tokenExpiry.WithLabelValues(deleted, DefaultBackend).Set(1)
+	tokenExpiry.WithLabelValues(other, DefaultBackend).Set(1)
+	setManagedResourceHealth(deleted, "DaemonSet", lbCSINodeName, storagev1.HealthStateRunning)
+	backendVolumes.WithLabelValues(deleted, DefaultBackend, "degraded").Set(1)
+	provisioningFailures.WithLabelValues(deleted, string(storagev1.ProvisioningFailureQuotaExceeded)).Set(2)
+	orphanedVolumes.WithLabelValues(DefaultBackend).Set(3)
+
+	deleteDurosMetrics(deleted)
+
+	// the series of a namespace are counted by deleting them, other tests may have left series of their own namespaces
+	tests := []struct {
+		name      string
+		gauge     *prometheus.GaugeVec
+		namespace string
+		want      int
+	}{
+		{name: "token expiry", gauge: tokenExpiry, namespace: deleted, want: 0},
+		{name: "token expiry of other namespaces", gauge: tokenExpiry, namespace: other, want: 1},
+		{name: "managed resource healthy", gauge: managedResourceHealthy, namespace: deleted, want: 0},
+		{name: "backend volumes", gauge: backendVolumes, namespace: deleted, want: 0},
+		{name: "provisioning failures", gauge: provisioningFailures, namespace: deleted, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.gauge.DeletePartialMatch(prometheus.Labels{"namespace": tt.namespace}); got != tt.want {
+			t.Errorf("%s: %d series of %s, want %d", tt.name, got, tt.namespace, tt.want)
+		}
+	}
+	// the orphaned volumes are not labelled with the namespace, they are all deleted
+	if got := testutil.CollectAndCount(orphanedVolumes); got != 0 {
+		t.Errorf("orphaned volumes: %d series, want 0", got)
+	}
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+// aclAllowNone is the acl of a volume which is not attached to any host
+const aclAllowNone = "ALLOW_NONE"
+
+// reconcileOrphanedVolumes detects detached volumes of the project which are not referenced by a persistent volume of the shoot.
+// Volumes of other clusters in the same project which are currently not attached, and volumes waiting to be imported, are reported as well.
+// The project is shared by all clusters of the metal project, therefore only volumes this controller has seen in use by a persistent volume
+// of its shoot before they were orphaned are owned, and only those are deleted after the grace period if cleanup is enabled.
+func (r *DurosReconciler) reconcileOrphanedVolumes(ctx context.Context, duros *storagev1.Duros, pvs []projectVolumes, shoot shootVolumes) error {
+	log := r.Log.WithName("orphans")
+
+	known := map[string]storagev1.OrphanedVolume{}
+	for _, o := range duros.Status.OrphanedVolumes {
+		known[o.UUID] = o
+	}
+
+	var (
+		now      = metav1.NewTime(time.Now())
+		key      = types.NamespacedName{Namespace: duros.Namespace, Name: duros.Name}
+		previous = r.swapUsedVolumes(key, nil)
+		used     = map[string]bool{}
+		orphans  []storagev1.OrphanedVolume
+	)
+	for _, pv := range pvs {
+		count := 0
+		for _, v := range pv.volumes {
+			if shoot.lookup(v.GetUUID(), v.GetName()) != nil {
+				used[v.GetUUID()] = true
+				continue
+			}
+			if isAttached(v) {
+				continue
+			}
+
+			o, ok := known[v.GetUUID()]
+			if !ok {
+				o.FirstSeen = now
+				r.Recorder.Eventf(duros, corev1.EventTypeWarning, "OrphanedVolume", "volume %s (%s) in backend %s is detached and not used by any persistent volume", v.GetName(), v.GetUUID(), pv.backend)
+			}
+			// the persistent volume disappeared since the last reconciliation
+			owned := o.Owned || previous[v.GetUUID()]
+
+			if r.OrphanCleanup && owned && now.Sub(o.FirstSeen.Time) > r.OrphanGracePeriod {
+				b, err := r.backend(pv.backend)
+				if err != nil {
+					return err
+				}
+				log.Info("deleting orphaned volume", "name", v.GetName(), "uuid", v.GetUUID(), "backend", pv.backend, "first-seen", o.FirstSeen.String())
+				_, err = b.Client.DeleteVolume(ctx, &durosv2.DeleteVolumeRequest{UUID: v.GetUUID(), ProjectName: v.GetProjectName()})
+				if err != nil {
+					return fmt.Errorf("unable to delete orphaned volume %s: %w", v.GetUUID(), err)
+				}
+				r.Recorder.Eventf(duros, corev1.EventTypeNormal, "OrphanedVolumeDeleted", "deleted volume %s (%s) in backend %s, it was orphaned since %s", v.GetName(), v.GetUUID(), pv.backend, o.FirstSeen.String())
+				continue
+			}
+
+			count++
+			orphans = append(orphans, storagev1.OrphanedVolume{
+				Name:      v.GetName(),
+				UUID:      v.GetUUID(),
+				Backend:   pv.backend,
+				Size:      *resource.NewQuantity(int64(v.GetSize()), resource.BinarySI), //nolint:gosec
+				FirstSeen: o.FirstSeen,
+				Owned:     owned,
+			})
+		}
+		orphanedVolumes.WithLabelValues(pv.backend).Set(float64(count))
+	}
+	r.swapUsedVolumes(key, used)
+
+	duros.Status.OrphanedVolumes, duros.Status.OrphanedVolumesTruncated = truncateOrphans(orphans)
+	if len(orphans) > 0 {
+		log.Info("orphaned volumes detected", "count", len(orphans))
+	}
+	return nil
+}
+
+// truncateOrphans sorts the orphans by name and keeps the first maxVolumeStatuses, owned orphans are kept first
+// because their ownership is only known from the status
+func truncateOrphans(orphans []storagev1.OrphanedVolume) ([]storagev1.OrphanedVolume, bool) {
+	slices.SortFunc(orphans, func(a, b storagev1.OrphanedVolume) int {
+		if a.Owned != b.Owned {
+			if a.Owned {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(orphans) > maxVolumeStatuses {
+		return orphans[:maxVolumeStatuses], true
+	}
+	return orphans, false
+}
+
+// swapUsedVolumes stores the uuids of the volumes used by the shoot of the given duros resource and returns the previously stored uuids
+func (r *DurosReconciler) swapUsedVolumes(key types.NamespacedName, used map[string]bool) map[string]bool {
+	r.usedVolumesMu.Lock()
+	defer r.usedVolumesMu.Unlock()
+	if r.usedVolumes == nil {
+		r.usedVolumes = map[types.NamespacedName]map[string]bool{}
+	}
+	previous := r.usedVolumes[key]
+	if used != nil {
+		r.usedVolumes[key] = used
+	}
+	return previous
+}
+
+// volumeUUIDFromHandle extracts the volume uuid from a volume handle of the lightbits csi plugin,
+// which looks like mgmt:10.0.0.1:443,10.0.0.2:443|nguid:<uuid>|proj:<project>|scheme:grpcs
+func volumeUUIDFromHandle(handle string) string {
+	for part := range strings.SplitSeq(handle, "|") {
+		if uuid, ok := strings.CutPrefix(part, "nguid:"); ok {
+			return uuid
+		}
+	}
+	return ""
+}
+
+// isAttached returns true if the acl of the volume allows access by any host
+func isAttached(v *durosv2.Volume) bool {
+	for _, acl := range v.GetACL().GetValues() {
+		if acl != aclAllowNone {
+			return true
+		}
+	}
+	return false
+}
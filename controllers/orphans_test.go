@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestReconcileOrphanedVolumes(t *testing.T) {
+	var deleted []string
+	r := &DurosReconciler{
+		Log:      logr.Discard(),
+		Recorder: record.NewFakeRecorder(10),
+		Backends: map[string]*Backend{
+			DefaultBackend: {Name: DefaultBackend, Client: &fakeDurosClient{deleteVolume: func(uuid string) error {
+				deleted = append(deleted, uuid)
+				return nil
+			}}},
+		},
+		OrphanCleanup:     true,
+		OrphanGracePeriod: time.Hour,
+	}
+	duros := &storagev1.Duros{ObjectMeta: metav1.ObjectMeta{Namespace: "shoot--p--c", Name: "shoot-default-storage"}}
+	pvs := []projectVolumes{{
+		backend: DefaultBackend,
+		volumes: []*durosv2.Volume{
+			{UUID: "uuid-a", Name: "pvc-a"},
+			{UUID: "uuid-b", Name: "pvc-b"},
+		},
+	}}
+	orphans := func() []string {
+		var result []string
+		for _, o := range duros.Status.OrphanedVolumes {
+			result = append(result, fmt.Sprintf("%s owned=%t", o.UUID, o.Owned))
+		}
+		return result
+	}
+
+	// pvc-a is used by the shoot, pvc-b belongs to another cluster
+	err := r.reconcileOrphanedVolumes(context.Background(), duros, pvs, shootVolumes{"uuid-a": &corev1.PersistentVolume{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"uuid-b owned=false"}; !slices.Equal(orphans(), want) {
+		t.Errorf("orphans = %v, want %v", orphans(), want)
+	}
+
+	// the persistent volume of pvc-a was deleted
+	err = r.reconcileOrphanedVolumes(context.Background(), duros, pvs, shootVolumes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"uuid-a owned=true", "uuid-b owned=false"}; !slices.Equal(orphans(), want) {
+		t.Errorf("orphans = %v, want %v", orphans(), want)
+	}
+
+	// after the grace period only the owned volume is deleted, its ownership is taken from the status
+	for i := range duros.Status.OrphanedVolumes {
+		duros.Status.OrphanedVolumes[i].FirstSeen = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	}
+	err = r.reconcileOrphanedVolumes(context.Background(), duros, pvs, shootVolumes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"uuid-a"}; !slices.Equal(deleted, want) {
+		t.Errorf("deleted = %v, want %v", deleted, want)
+	}
+	if want := []string{"uuid-b owned=false"}; !slices.Equal(orphans(), want) {
+		t.Errorf("orphans = %v, want %v", orphans(), want)
+	}
+}
+
+func TestTruncateOrphans(t *testing.T) {
+	var orphans []storagev1.OrphanedVolume
+	for i := range maxVolumeStatuses + 1 {
+		orphans = append(orphans, storagev1.OrphanedVolume{Name: fmt.Sprintf("pvc-%03d", i)})
+	}
+	orphans[maxVolumeStatuses].Owned = true
+
+	got, truncated := truncateOrphans(orphans)
+	if !truncated {
+		t.Error("expected the orphans to be truncated")
+	}
+	if len(got) != maxVolumeStatuses {
+		t.Errorf("len = %d, want %d", len(got), maxVolumeStatuses)
+	}
+	if !got[0].Owned {
+		t.Errorf("expected the owned orphan to be kept first, got %s", got[0].Name)
+	}
+}
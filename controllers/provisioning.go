@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+const (
+	// provisioningFailureWindow is the age of the newest event of a claim up to which its failure is reported
+	provisioningFailureWindow = time.Hour
+	// provisioningPendingThreshold is the age of a claim after which waiting for the csi provisioner is reported as failure
+	provisioningPendingThreshold = 5 * time.Minute
+	// maxProvisioningFailureClaims limits the number of claims listed per reason to keep the object small
+	maxProvisioningFailureClaims = 5
+	// provisioningEventsPageSize is the number of events listed per call to the apiserver of the shoot
+	provisioningEventsPageSize = 250
+	// maxProvisioningEvents limits the events read per reason and reconciliation, failures beyond it are not reported
+	maxProvisioningEvents = 1000
+
+	// the reasons of the events the csi provisioner records on the claims
+	eventReasonProvisioningFailed   = "ProvisioningFailed"
+	eventReasonExternalProvisioning = "ExternalProvisioning"
+
+	// the field selectors of events supported by the apiserver
+	eventInvolvedObjectKindField = "involvedObject.kind"
+	eventReasonField             = "reason"
+)
+
+// claimFailure is the most recent provisioning failure of a single claim
+type claimFailure struct {
+	claim        types.NamespacedName
+	storageClass string
+	reason       storagev1.ProvisioningFailureReason
+	message      string
+	timestamp    time.Time
+}
+
+// setProvisioningFailures aggregates the recent provisioning failures of the pending claims of the managed storage classes in the shoot,
+// the claims are the ones listed for the volumes of this reconciliation.
+func (r *DurosReconciler) setProvisioningFailures(ctx context.Context, duros *storagev1.Duros, claims []corev1.PersistentVolumeClaim) error {
+	log := r.Log.WithName("provisioning")
+
+	failures, err := r.listProvisioningFailures(ctx, duros.Spec.StorageClasses, claims, time.Now())
+	if err != nil {
+		return err
+	}
+
+	duros.Status.ProvisioningFailures = aggregateProvisioningFailures(failures)
+
+	provisioningFailures.DeletePartialMatch(prometheus.Labels{"namespace": duros.Namespace})
+	for _, f := range duros.Status.ProvisioningFailures {
+		provisioningFailures.WithLabelValues(duros.Namespace, string(f.Reason)).Set(float64(f.Count))
+	}
+	if len(failures) > 0 {
+		log.Info("persistent volume claims are not provisioned", "claims", len(failures))
+	}
+	return nil
+}
+
+// listProvisioningFailures returns the most recent failure of every pending claim of the given storage classes.
+// The events are listed with field selectors by the apiserver of the shoot, only if there are pending claims.
+func (r *DurosReconciler) listProvisioningFailures(ctx context.Context, scs []storagev1.StorageClass, claims []corev1.PersistentVolumeClaim, now time.Time) ([]claimFailure, error) {
+	managed := map[string]bool{}
+	for _, sc := range scs {
+		managed[sc.Name] = true
+	}
+
+	pending := map[types.UID]*corev1.PersistentVolumeClaim{}
+	for i := range claims {
+		c := &claims[i]
+		if c.Status.Phase != corev1.ClaimPending || c.Spec.StorageClassName == nil || !managed[*c.Spec.StorageClassName] {
+			continue
+		}
+		pending[c.UID] = c
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	latest := map[types.UID]claimFailure{}
+	for _, eventReason := range []string{eventReasonProvisioningFailed, eventReasonExternalProvisioning} {
+		events, err := r.listClaimEvents(ctx, eventReason)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list %s events: %w", eventReason, err)
+		}
+		for i := range events {
+			e := &events[i]
+			c, ok := pending[e.InvolvedObject.UID]
+			if !ok {
+				continue
+			}
+			timestamp := eventTime(e)
+			if now.Sub(timestamp) > provisioningFailureWindow {
+				continue
+			}
+
+			var reason storagev1.ProvisioningFailureReason
+			switch e.Reason {
+			case eventReasonProvisioningFailed:
+				reason = classifyProvisioningFailure(e.Message)
+			case eventReasonExternalProvisioning:
+				if now.Sub(c.CreationTimestamp.Time) < provisioningPendingThreshold {
+					continue
+				}
+				reason = storagev1.ProvisioningFailurePending
+			default:
+				continue
+			}
+
+			// a reported failure is more specific than waiting for the provisioner
+			if l, ok := latest[c.UID]; ok {
+				isPending, wasPending := reason == storagev1.ProvisioningFailurePending, l.reason == storagev1.ProvisioningFailurePending
+				if isPending && !wasPending {
+					continue
+				}
+				if isPending == wasPending && !timestamp.After(l.timestamp) {
+					continue
+				}
+			}
+			latest[c.UID] = claimFailure{
+				claim:        types.NamespacedName{Namespace: c.Namespace, Name: c.Name},
+				storageClass: *c.Spec.StorageClassName,
+				reason:       reason,
+				message:      e.Message,
+				timestamp:    timestamp,
+			}
+		}
+	}
+
+	result := make([]claimFailure, 0, len(latest))
+	for _, f := range latest {
+		result = append(result, f)
+	}
+	slices.SortFunc(result, func(a, b claimFailure) int {
+		return strings.Compare(a.claim.String(), b.claim.String())
+	})
+	return result, nil
+}
+
+// listClaimEvents lists the events of claims with the given reason in pages, at most maxProvisioningEvents are returned
+func (r *DurosReconciler) listClaimEvents(ctx context.Context, reason string) ([]corev1.Event, error) {
+	var (
+		result []corev1.Event
+		next   string
+	)
+	for {
+		events := &corev1.EventList{}
+		err := r.ShootReader.List(ctx, events, client.MatchingFields{
+			eventInvolvedObjectKindField: "PersistentVolumeClaim",
+			eventReasonField:             reason,
+		}, client.Limit(provisioningEventsPageSize), client.Continue(next))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, events.Items...)
+		next = events.Continue
+		if next == "" {
+			return result, nil
+		}
+		if len(result) >= maxProvisioningEvents {
+			r.Log.WithName("provisioning").Info("too many events, not reading all of them", "reason", reason, "limit", maxProvisioningEvents)
+			return result[:maxProvisioningEvents], nil
+		}
+	}
+}
+
+// aggregateProvisioningFailures groups the failures of the claims by reason
+func aggregateProvisioningFailures(failures []claimFailure) []storagev1.ProvisioningFailure {
+	byReason := map[storagev1.ProvisioningFailureReason]*storagev1.ProvisioningFailure{}
+	for _, f := range failures {
+		agg, ok := byReason[f.reason]
+		if !ok {
+			agg = &storagev1.ProvisioningFailure{Reason: f.reason}
+			byReason[f.reason] = agg
+		}
+		agg.Count++
+		if !slices.Contains(agg.StorageClasses, f.storageClass) {
+			agg.StorageClasses = append(agg.StorageClasses, f.storageClass)
+		}
+		if len(agg.Claims) < maxProvisioningFailureClaims {
+			agg.Claims = append(agg.Claims, f.claim.String())
+		}
+		if f.timestamp.After(agg.LastTimestamp.Time) {
+			agg.Message = f.message
+			agg.LastTimestamp = metav1.NewTime(f.timestamp)
+		}
+	}
+
+	var result []storagev1.ProvisioningFailure
+	for _, agg := range byReason {
+		slices.Sort(agg.StorageClasses)
+		result = append(result, *agg)
+	}
+	slices.SortFunc(result, func(a, b storagev1.ProvisioningFailure) int {
+		return strings.Compare(string(a.Reason), string(b.Reason))
+	})
+	return result
+}
+
+// classifyProvisioningFailure derives the reason from the message of a ProvisioningFailed event,
+// the csi provisioner includes the grpc status returned by the lightbits csi plugin in the message
+func classifyProvisioningFailure(message string) storagev1.ProvisioningFailureReason {
+	msg := strings.ToLower(message)
+	containsAny := func(substrs ...string) bool {
+		return slices.ContainsFunc(substrs, func(s string) bool {
+			return strings.Contains(msg, s)
+		})
+	}
+
+	switch {
+	case containsAny("code = unauthenticated", "code = permissiondenied", "token is expired", "unauthorized"):
+		return storagev1.ProvisioningFailureUnauthenticated
+	case containsAny("quota"):
+		return storagev1.ProvisioningFailureQuotaExceeded
+	case containsAny("code = resourceexhausted", "no space", "insufficient capacity", "not enough capacity"):
+		return storagev1.ProvisioningFailureInsufficientCapacity
+	case containsAny("replica"):
+		return storagev1.ProvisioningFailureInvalidReplicaCount
+	case containsAny("code = unavailable", "code = deadlineexceeded", "connection refused"):
+		return storagev1.ProvisioningFailureBackendUnavailable
+	default:
+		return storagev1.ProvisioningFailureOther
+	}
+}
+
+// eventTime returns the time the event was last observed
+func eventTime(e *corev1.Event) time.Time {
+	switch {
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestClassifyProvisioningFailure(t *testing.T) {
+	tests := []struct {
+		message string
+		want    storagev1.ProvisioningFailureReason
+	}{
+		{
+			message: `failed to provision volume with StorageClass "partition-silver": rpc error: code = Unauthenticated desc = token is expired`,
+			want:    storagev1.ProvisioningFailureUnauthenticated,
+		},
+		{
+			message: `failed to provision volume with StorageClass "partition-silver": rpc error: code = PermissionDenied desc = access denied`,
+			want:    storagev1.ProvisioningFailureUnauthenticated,
+		},
+		{
+			message: `failed to provision volume with StorageClass "partition-silver": rpc error: code = ResourceExhausted desc = project quota exceeded`,
+			want:    storagev1.ProvisioningFailureQuotaExceeded,
+		},
+		{
+			message: `failed to provision volume with StorageClass "partition-silver": rpc error: code = ResourceExhausted desc = out of space`,
+			want:    storagev1.ProvisioningFailureInsufficientCapacity,
+		},
+		{
+			message: `failed to provision volume with StorageClass "partition-gold": rpc error: code = InvalidArgument desc = invalid replica count 3`,
+			want:    storagev1.ProvisioningFailureInvalidReplicaCount,
+		},
+		{
+			message: `failed to provision volume with StorageClass "partition-silver": rpc error: code = Unavailable desc = connection refused`,
+			want:    storagev1.ProvisioningFailureBackendUnavailable,
+		},
+		{
+			message: `failed to provision volume with StorageClass "partition-silver": rpc error: code = DeadlineExceeded desc = context deadline exceeded`,
+			want:    storagev1.ProvisioningFailureBackendUnavailable,
+		},
+		{
+			message: `failed to provision volume with StorageClass "partition-silver": rpc error: code = Internal desc = something went wrong`,
+			want:    storagev1.ProvisioningFailureOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.want), func(t *testing.T) {
+			if got := classifyProvisioningFailure(tt.message); got != tt.want {
+				t.Errorf("classifyProvisioningFailure(%q) = %s, want %s", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateProvisioningFailures(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	failure := func(name, storageClass string, reason storagev1.ProvisioningFailureReason, age time.Duration) claimFailure {
+		return claimFailure{
+			claim:        types.NamespacedName{Namespace: "default", Name: name},
+			storageClass: storageClass,
+			reason:       reason,
+			message:      name + " failed",
+			timestamp:    now.Add(-age),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		failures []claimFailure
+		want     []storagev1.ProvisioningFailure
+	}{
+		{
+			name: "no failures",
+		},
+		{
+			name: "failures are grouped by reason",
+			failures: []claimFailure{
+				failure("a", "partition-silver", storagev1.ProvisioningFailureQuotaExceeded, time.Minute),
+				failure("b", "partition-gold", storagev1.ProvisioningFailureQuotaExceeded, 2*time.Minute),
+				failure("c", "partition-silver", storagev1.ProvisioningFailurePending, time.Minute),
+			},
+			want: []storagev1.ProvisioningFailure{
+				{
+					Reason:         storagev1.ProvisioningFailurePending,
+					Count:          1,
+					StorageClasses: []string{"partition-silver"},
+					Claims:         []string{"default/c"},
+					Message:        "c failed",
+					LastTimestamp:  metav1.NewTime(now.Add(-time.Minute)),
+				},
+				{
+					Reason:         storagev1.ProvisioningFailureQuotaExceeded,
+					Count:          2,
+					StorageClasses: []string{"partition-gold", "partition-silver"},
+					Claims:         []string{"default/a", "default/b"},
+					Message:        "a failed",
+					LastTimestamp:  metav1.NewTime(now.Add(-time.Minute)),
+				},
+			},
+		},
+		{
+			name: "claims are limited and the latest message is kept",
+			failures: []claimFailure{
+				failure("a", "partition-silver", storagev1.ProvisioningFailureOther, 6*time.Minute),
+				failure("b", "partition-silver", storagev1.ProvisioningFailureOther, 5*time.Minute),
+				failure("c", "partition-silver", storagev1.ProvisioningFailureOther, 4*time.Minute),
+				failure("d", "partition-silver", storagev1.ProvisioningFailureOther, 3*time.Minute),
+				failure("e", "partition-silver", storagev1.ProvisioningFailureOther, time.Minute),
+				failure("f", "partition-silver", storagev1.ProvisioningFailureOther, 2*time.Minute),
+			},
+			want: []storagev1.ProvisioningFailure{
+				{
+					Reason:         storagev1.ProvisioningFailureOther,
+					Count:          6,
+					StorageClasses: []string{"partition-silver"},
+					Claims:         []string{"default/a", "default/b", "default/c", "default/d", "default/e"},
+					Message:        "e failed",
+					LastTimestamp:  metav1.NewTime(now.Add(-time.Minute)),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aggregateProvisioningFailures(tt.failures)
+			if !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("aggregateProvisioningFailures() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListProvisioningFailures(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	claim := func(name, storageClass string, phase corev1.PersistentVolumeClaimPhase) corev1.PersistentVolumeClaim {
+		return corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name), CreationTimestamp: metav1.NewTime(now.Add(-10 * time.Minute))},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: new(storageClass)},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: phase},
+		}
+	}
+	event := func(name, kind, claim, reason, message string, age time.Duration) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: name},
+			InvolvedObject: corev1.ObjectReference{Kind: kind, Namespace: "default", Name: claim, UID: types.UID(claim)},
+			Reason:         reason,
+			Message:        message,
+			LastTimestamp:  metav1.NewTime(now.Add(-age)),
+		}
+	}
+
+	tests := []struct {
+		name      string
+		claims    []corev1.PersistentVolumeClaim
+		events    []client.Object
+		want      []claimFailure
+		wantLists int
+	}{
+		{
+			name:   "events are not listed without pending claims",
+			claims: []corev1.PersistentVolumeClaim{claim("bound", "partition-silver", corev1.ClaimBound)},
+			events: []client.Object{event("bound.1", "PersistentVolumeClaim", "bound", eventReasonProvisioningFailed, "rpc error: code = Unavailable", time.Minute)},
+		},
+		{
+			name: "latest failure of the pending claims of managed storage classes",
+			claims: []corev1.PersistentVolumeClaim{
+				claim("a", "partition-silver", corev1.ClaimPending),
+				claim("b", "partition-silver", corev1.ClaimPending),
+				claim("unmanaged", "local-storage", corev1.ClaimPending),
+			},
+			events: []client.Object{
+				event("a.1", "PersistentVolumeClaim", "a", eventReasonProvisioningFailed, "rpc error: code = Unavailable", 3*time.Minute),
+				event("a.2", "PersistentVolumeClaim", "a", eventReasonProvisioningFailed, "project quota exceeded", 2*time.Minute),
+				event("a.3", "PersistentVolumeClaim", "a", eventReasonExternalProvisioning, "waiting for a volume to be created", time.Minute),
+				event("b.1", "PersistentVolumeClaim", "b", eventReasonExternalProvisioning, "waiting for a volume to be created", time.Minute),
+				event("b.2", "PersistentVolumeClaim", "b", eventReasonProvisioningFailed, "rpc error: code = Unavailable", 2*time.Hour),
+				event("b.3", "PersistentVolumeClaim", "b", "WaitForFirstConsumer", "waiting for first consumer", time.Minute),
+				event("unmanaged.1", "PersistentVolumeClaim", "unmanaged", eventReasonProvisioningFailed, "rpc error: code = Unavailable", time.Minute),
+				event("pod.1", "Pod", "a", eventReasonProvisioningFailed, "rpc error: code = Unavailable", time.Minute),
+			},
+			want: []claimFailure{
+				{
+					claim:        types.NamespacedName{Namespace: "default", Name: "a"},
+					storageClass: "partition-silver",
+					reason:       storagev1.ProvisioningFailureQuotaExceeded,
+					message:      "project quota exceeded",
+					timestamp:    now.Add(-2 * time.Minute),
+				},
+				{
+					claim:        types.NamespacedName{Namespace: "default", Name: "b"},
+					storageClass: "partition-silver",
+					reason:       storagev1.ProvisioningFailurePending,
+					message:      "waiting for a volume to be created",
+					timestamp:    now.Add(-time.Minute),
+				},
+			},
+			wantLists: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lists := 0
+			r := &DurosReconciler{
+				Log: logr.Discard(),
+				ShootReader: interceptor.NewClient(newFakeClient(tt.events...).(client.WithWatch), interceptor.Funcs{
+					List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+						if _, ok := list.(*corev1.EventList); !ok {
+							t.Errorf("unexpected list of %T, the claims are passed in", list)
+						}
+						lists++
+						return c.List(ctx, list, opts...)
+					},
+				}),
+			}
+
+			got, err := r.listProvisioningFailures(context.Background(), []storagev1.StorageClass{{Name: "partition-silver"}}, tt.claims, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(got, tt.want, func(a, b claimFailure) bool {
+				return a.claim == b.claim && a.storageClass == b.storageClass && a.reason == b.reason && a.message == b.message && a.timestamp.Equal(b.timestamp)
+			}) {
+				t.Errorf("listProvisioningFailures() = %+v, want %+v", got, tt.want)
+			}
+			if lists != tt.wantLists {
+				t.Errorf("listed events %d times, want %d", lists, tt.wantLists)
+			}
+		})
+	}
+}
+
+func TestListClaimEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		events    int
+		want      int
+		wantLists int
+	}{
+		{name: "single page", events: 10, want: 10, wantLists: 1},
+		{name: "multiple pages", events: provisioningEventsPageSize + 1, want: provisioningEventsPageSize + 1, wantLists: 2},
+		{name: "too many events", events: 10 * maxProvisioningEvents, want: maxProvisioningEvents, wantLists: maxProvisioningEvents / provisioningEventsPageSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lists := 0
+			r := &DurosReconciler{
+				Log: logr.Discard(),
+				// the fake client does not paginate, the pages are returned by the interceptor
+				ShootReader: interceptor.NewClient(newFakeClient().(client.WithWatch), interceptor.Funcs{
+					List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+						lists++
+						o := &client.ListOptions{}
+						o.ApplyOptions(opts)
+						if o.Limit != provisioningEventsPageSize {
+							t.Errorf("limit = %d, want %d", o.Limit, provisioningEventsPageSize)
+						}
+						offset := 0
+						if o.Continue != "" {
+							offset, _ = strconv.Atoi(o.Continue)
+						}
+						events := list.(*corev1.EventList)
+						for i := offset; i < min(offset+int(o.Limit), tt.events); i++ {
+							events.Items = append(events.Items, corev1.Event{ObjectMeta: metav1.ObjectMeta{Name: strconv.Itoa(i)}})
+						}
+						if offset+int(o.Limit) < tt.events {
+							events.Continue = strconv.Itoa(offset + int(o.Limit))
+						}
+						return nil
+					},
+				}),
+			}
+
+			events, err := r.listClaimEvents(context.Background(), eventReasonProvisioningFailed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != tt.want || lists != tt.wantLists {
+				t.Errorf("%d events in %d lists, want %d events in %d lists", len(events), lists, tt.want, tt.wantLists)
+			}
+		})
+	}
+}
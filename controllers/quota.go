@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+// quotaPolicyName is the name of the validating admission policy, its binding and its params configmap in the shoot
+const quotaPolicyName = "duros-quota"
+
+// quotaPolicyValidations deny claims and snapshots of the managed classes which exceed the remaining quota of the project.
+// The remaining quota is written into the params configmap on every reconciliation, a missing key means unlimited.
+var quotaPolicyValidations = []admissionv1.Validation{
+	{
+		Expression: `request.resource.resource != 'persistentvolumeclaims' || request.operation != 'CREATE' || !variables.managedClaim ||
+  !('remainingVolumes' in params.data) || int(params.data.remainingVolumes) > 0`,
+		Message: "the volume quota of the lightos project is exhausted",
+		Reason:  new(metav1.StatusReasonForbidden),
+	},
+	{
+		Expression: `request.resource.resource != 'persistentvolumeclaims' || !variables.managedClaim ||
+  !('remainingCapacity' in params.data) || variables.requestedCapacity.compareTo(quantity(params.data.remainingCapacity)) <= 0`,
+		MessageExpression: `'the claim exceeds the remaining capacity quota of the lightos project of ' + params.data.remainingCapacity`,
+		Reason:            new(metav1.StatusReasonForbidden),
+	},
+	{
+		Expression: `request.resource.resource != 'volumesnapshots' || !variables.managedSnapshot ||
+  !('remainingSnapshots' in params.data) || int(params.data.remainingSnapshots) > 0`,
+		Message: "the snapshot quota of the lightos project is exhausted",
+		Reason:  new(metav1.StatusReasonForbidden),
+	},
+}
+
+// quotaPolicyVariables are evaluated lazily, the claim variables only for claims and the snapshot variable only for snapshots
+var quotaPolicyVariables = []admissionv1.Variable{
+	{
+		Name:       "managedClaim",
+		Expression: `has(object.spec.storageClassName) && object.spec.storageClassName in params.data.storageClasses.split(',')`,
+	},
+	{
+		// an expansion only requests the difference to the current size
+		Name: "requestedCapacity",
+		Expression: `request.operation == 'CREATE' ? quantity(object.spec.resources.requests.storage) :
+  quantity(object.spec.resources.requests.storage).sub(quantity(oldObject.spec.resources.requests.storage))`,
+	},
+	{
+		Name: "managedSnapshot",
+		Expression: `has(object.spec.volumeSnapshotClassName) ? object.spec.volumeSnapshotClassName in params.data.snapshotClasses.split(',') :
+  params.data.defaultSnapshotClass == 'true'`,
+	},
+}
+
+// reconcileQuotaPolicy enforces the quota of the project in the shoot with a validating admission policy.
+// LightOS has no limits on projects, the usage of the project in all backends is compared with the quota by the controller
+// and the remaining quota is handed to the policy. The policy requires admissionregistration.k8s.io/v1, which is served from kubernetes 1.30,
+// in older shoots the quota is only reported in the status.
+func (r *DurosReconciler) reconcileQuotaPolicy(ctx context.Context, duros *storagev1.Duros) error {
+	log := r.Log.WithName("quota")
+
+	if duros.Status.Quota == nil {
+		meta.RemoveStatusCondition(&duros.Status.Conditions, storagev1.ConditionQuotaEnforced)
+		return r.deleteQuotaPolicy(ctx)
+	}
+
+	condition := metav1.Condition{
+		Type:               storagev1.ConditionQuotaEnforced,
+		Status:             metav1.ConditionTrue,
+		Reason:             "AdmissionPolicy",
+		Message:            fmt.Sprintf("claims and snapshots exceeding the quota are denied by the validatingadmissionpolicy %s", quotaPolicyName),
+		ObservedGeneration: duros.Generation,
+	}
+	defer func() {
+		meta.SetStatusCondition(&duros.Status.Conditions, condition)
+	}()
+
+	_, err := r.Shoot.RESTMapper().KindFor(admissionv1.SchemeGroupVersion.WithResource("validatingadmissionpolicies"))
+	if err != nil {
+		log.Info("validatingadmissionpolicies are not supported by the shoot, the quota is only reported")
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Unsupported"
+		condition.Message = "the shoot does not serve validatingadmissionpolicies in admissionregistration.k8s.io/v1, the quota is only reported"
+		return nil
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: quotaPolicyName, Namespace: namespace}}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, cm, func() error {
+		cm.Annotations = map[string]string{
+			metalClusterDescriptionTag: durosDoNotEditMessage,
+		}
+		cm.Data = quotaPolicyParams(duros.Status.Quota, duros.Spec.StorageClasses, duros.Spec.SnapshotClasses)
+		return nil
+	})
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Error"
+		condition.Message = err.Error()
+		return fmt.Errorf("unable to deploy quota params: %w", err)
+	}
+	log.Info("configmap", "name", cm.Name, "operation", op)
+
+	policy := &admissionv1.ValidatingAdmissionPolicy{ObjectMeta: metav1.ObjectMeta{Name: quotaPolicyName}}
+	op, err = controllerutil.CreateOrUpdate(ctx, r.Shoot, policy, func() error {
+		policy.Annotations = map[string]string{
+			metalClusterDescriptionTag: durosDoNotEditMessage,
+		}
+		policy.Spec = admissionv1.ValidatingAdmissionPolicySpec{
+			FailurePolicy: new(admissionv1.Fail),
+			ParamKind: &admissionv1.ParamKind{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+			},
+			MatchConstraints: &admissionv1.MatchResources{
+				ResourceRules: []admissionv1.NamedRuleWithOperations{
+					{
+						RuleWithOperations: admissionv1.RuleWithOperations{
+							Operations: []admissionv1.OperationType{admissionv1.Create, admissionv1.Update},
+							Rule: admissionv1.Rule{
+								APIGroups:   []string{""},
+								APIVersions: []string{"v1"},
+								Resources:   []string{"persistentvolumeclaims"},
+							},
+						},
+					},
+					{
+						RuleWithOperations: admissionv1.RuleWithOperations{
+							Operations: []admissionv1.OperationType{admissionv1.Create},
+							Rule: admissionv1.Rule{
+								APIGroups:   []string{"snapshot.storage.k8s.io"},
+								APIVersions: []string{"*"},
+								Resources:   []string{"volumesnapshots"},
+							},
+						},
+					},
+				},
+			},
+			Variables:   quotaPolicyVariables,
+			Validations: quotaPolicyValidations,
+		}
+		return nil
+	})
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Error"
+		condition.Message = err.Error()
+		return fmt.Errorf("unable to deploy quota policy: %w", err)
+	}
+	log.Info("validatingadmissionpolicy", "name", policy.Name, "operation", op)
+
+	binding := &admissionv1.ValidatingAdmissionPolicyBinding{ObjectMeta: metav1.ObjectMeta{Name: quotaPolicyName}}
+	op, err = controllerutil.CreateOrUpdate(ctx, r.Shoot, binding, func() error {
+		binding.Annotations = map[string]string{
+			metalClusterDescriptionTag: durosDoNotEditMessage,
+		}
+		binding.Spec = admissionv1.ValidatingAdmissionPolicyBindingSpec{
+			PolicyName: quotaPolicyName,
+			ParamRef: &admissionv1.ParamRef{
+				Name:                    quotaPolicyName,
+				Namespace:               namespace,
+				ParameterNotFoundAction: new(admissionv1.AllowAction),
+			},
+			ValidationActions: []admissionv1.ValidationAction{admissionv1.Deny},
+		}
+		return nil
+	})
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Error"
+		condition.Message = err.Error()
+		return fmt.Errorf("unable to deploy quota policy binding: %w", err)
+	}
+	log.Info("validatingadmissionpolicybinding", "name", binding.Name, "operation", op)
+	return nil
+}
+
+// deleteQuotaPolicy removes the quota policy from the shoot, the binding first
+func (r *DurosReconciler) deleteQuotaPolicy(ctx context.Context) error {
+	objs := []client.Object{
+		&admissionv1.ValidatingAdmissionPolicyBinding{ObjectMeta: metav1.ObjectMeta{Name: quotaPolicyName}},
+		&admissionv1.ValidatingAdmissionPolicy{ObjectMeta: metav1.ObjectMeta{Name: quotaPolicyName}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: quotaPolicyName, Namespace: namespace}},
+	}
+	for _, obj := range objs {
+		err := r.Shoot.Delete(ctx, obj)
+		if meta.IsNoMatchError(err) || client.IgnoreNotFound(err) == nil {
+			continue
+		}
+		return fmt.Errorf("unable to delete %s: %w", quotaPolicyName, err)
+	}
+	return nil
+}
+
+// quotaPolicyParams returns the params of the quota policy, limits of the quota which are not set are left out
+func quotaPolicyParams(quota *storagev1.QuotaStatus, scs []storagev1.StorageClass, snapshotClasses []storagev1.SnapshotClass) map[string]string {
+	if len(snapshotClasses) == 0 {
+		snapshotClasses = defaultSnapshotClasses
+	}
+
+	var (
+		storageClassNames  []string
+		snapshotClassNames []string
+		defaultSnapshot    bool
+	)
+	for _, sc := range scs {
+		storageClassNames = append(storageClassNames, sc.Name)
+	}
+	for _, sc := range snapshotClasses {
+		snapshotClassNames = append(snapshotClassNames, sc.Name)
+		defaultSnapshot = defaultSnapshot || sc.Default
+	}
+
+	params := map[string]string{
+		"storageClasses":       strings.Join(storageClassNames, ","),
+		"snapshotClasses":      strings.Join(snapshotClassNames, ","),
+		"defaultSnapshotClass": strconv.FormatBool(defaultSnapshot),
+	}
+	if quota.Hard.Capacity != nil && quota.Used.Capacity != nil {
+		remaining := quota.Hard.Capacity.DeepCopy()
+		remaining.Sub(*quota.Used.Capacity)
+		if remaining.Sign() < 0 {
+			remaining = *resource.NewQuantity(0, resource.BinarySI)
+		}
+		params["remainingCapacity"] = remaining.String()
+	}
+	if quota.Hard.Volumes != nil && quota.Used.Volumes != nil {
+		params["remainingVolumes"] = strconv.Itoa(max(*quota.Hard.Volumes-*quota.Used.Volumes, 0))
+	}
+	if quota.Hard.Snapshots != nil && quota.Used.Snapshots != nil {
+		params["remainingSnapshots"] = strconv.Itoa(max(*quota.Hard.Snapshots-*quota.Used.Snapshots, 0))
+	}
+	return params
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"maps"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestQuotaPolicyParams(t *testing.T) {
+	scs := []storagev1.StorageClass{{Name: "partition-silver"}, {Name: "partition-gold"}}
+
+	tests := []struct {
+		name            string
+		quota           *storagev1.QuotaStatus
+		snapshotClasses []storagev1.SnapshotClass
+		want            map[string]string
+	}{
+		{
+			name: "all limits",
+			quota: &storagev1.QuotaStatus{
+				Hard: storagev1.Quota{Capacity: new(resource.MustParse("10Ti")), Volumes: new(200), Snapshots: new(500)},
+				Used: storagev1.Quota{Capacity: new(resource.MustParse("4Ti")), Volumes: new(20), Snapshots: new(100)},
+			},
+			want: map[string]string{
+				"storageClasses":       "partition-silver,partition-gold",
+				"snapshotClasses":      "partition-snapshot",
+				"defaultSnapshotClass": "true",
+				"remainingCapacity":    "6Ti",
+				"remainingVolumes":     "180",
+				"remainingSnapshots":   "400",
+			},
+		},
+		{
+			name: "only volumes limited",
+			quota: &storagev1.QuotaStatus{
+				Hard: storagev1.Quota{Volumes: new(10)},
+				Used: storagev1.Quota{Capacity: new(resource.MustParse("4Ti")), Volumes: new(3), Snapshots: new(1)},
+			},
+			snapshotClasses: []storagev1.SnapshotClass{{Name: "a"}, {Name: "b"}},
+			want: map[string]string{
+				"storageClasses":       "partition-silver,partition-gold",
+				"snapshotClasses":      "a,b",
+				"defaultSnapshotClass": "false",
+				"remainingVolumes":     "7",
+			},
+		},
+		{
+			name: "exceeded limits are exhausted",
+			quota: &storagev1.QuotaStatus{
+				Hard: storagev1.Quota{Capacity: new(resource.MustParse("1Ti")), Volumes: new(10), Snapshots: new(5)},
+				Used: storagev1.Quota{Capacity: new(resource.MustParse("2Ti")), Volumes: new(12), Snapshots: new(5)},
+			},
+			snapshotClasses: []storagev1.SnapshotClass{{Name: "a"}, {Name: "b", Default: true}},
+			want: map[string]string{
+				"storageClasses":       "partition-silver,partition-gold",
+				"snapshotClasses":      "a,b",
+				"defaultSnapshotClass": "true",
+				"remainingCapacity":    "0",
+				"remainingVolumes":     "0",
+				"remainingSnapshots":   "0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := quotaPolicyParams(tt.quota, scs, tt.snapshotClasses)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("quotaPolicyParams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"time"
 
@@ -16,10 +18,11 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	rbac "k8s.io/api/rbac/v1"
 	storage "k8s.io/api/storage/v1"
-	storagev1beta1 "k8s.io/api/storage/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -35,6 +38,8 @@ import (
 const (
 	namespace   = "kube-system"
 	provisioner = "csi.lightbitslabs.com"
+	// defaultFSType is the filesystem of volumes whose storage class sets no fstype
+	defaultFSType = "ext4"
 
 	// nolint: gosec
 	storageClassCredentialsRef = "lb-csi-creds"
@@ -42,6 +47,10 @@ const (
 	lbCSIControllerName = "lb-csi-controller"
 	lbCSINodeName       = "lb-csi-node"
 
+	// livenessProbePort is the healthz port of the liveness-probe sidecar, the node pods use the host network and need a different port
+	livenessProbePort     = 9808
+	nodeLivenessProbePort = 9809
+
 	tokenLifetime      = 8 * 24 * time.Hour
 	tokenRenewalBefore = 1 * 24 * time.Hour
 )
@@ -163,6 +172,11 @@ var (
 					Resources: []string{"nodes"},
 					Verbs:     []string{"get", "list", "watch"},
 				},
+				{
+					APIGroups: []string{"storage.k8s.io"},
+					Resources: []string{"volumeattributesclasses"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
 			},
 		}
 	}
@@ -206,7 +220,7 @@ var (
 				{
 					APIGroups: []string{""},
 					Resources: []string{"persistentvolumes"},
-					Verbs:     []string{"get", "list", "watch", "create", "delete"},
+					Verbs:     []string{"get", "list", "watch", "create", "delete", "patch"},
 				},
 				{
 					APIGroups: []string{""},
@@ -228,6 +242,11 @@ var (
 					Resources: []string{"pods"},
 					Verbs:     []string{"get", "list", "watch"},
 				},
+				{
+					APIGroups: []string{"storage.k8s.io"},
+					Resources: []string{"volumeattributesclasses"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
 			},
 		}
 	}
@@ -283,6 +302,31 @@ var (
 					Resources: []string{"volumesnapshotcontents/status"},
 					Verbs:     []string{"update", "patch"},
 				},
+				{
+					APIGroups: []string{"groupsnapshot.storage.k8s.io"},
+					Resources: []string{"volumegroupsnapshotclasses"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
+				{
+					APIGroups: []string{"groupsnapshot.storage.k8s.io"},
+					Resources: []string{"volumegroupsnapshotcontents"},
+					Verbs:     []string{"create", "get", "list", "watch", "update", "patch", "delete"},
+				},
+				{
+					APIGroups: []string{"groupsnapshot.storage.k8s.io"},
+					Resources: []string{"volumegroupsnapshotcontents/status"},
+					Verbs:     []string{"update", "patch"},
+				},
+				{
+					APIGroups: []string{"groupsnapshot.storage.k8s.io"},
+					Resources: []string{"volumegroupsnapshots"},
+					Verbs:     []string{"get", "list", "watch", "update", "patch"},
+				},
+				{
+					APIGroups: []string{"groupsnapshot.storage.k8s.io"},
+					Resources: []string{"volumegroupsnapshots/status"},
+					Verbs:     []string{"update", "patch"},
+				},
 			},
 		}
 	}
@@ -312,6 +356,83 @@ var (
 					Resources: []string{"volumesnapshotcontents"},
 					Verbs:     []string{"create", "get", "list", "watch", "update", "patch", "delete"},
 				},
+				{
+					APIGroups: []string{"snapshot.storage.k8s.io"},
+					Resources: []string{"volumesnapshotcontents/status"},
+					Verbs:     []string{"update", "patch"},
+				},
+				{
+					APIGroups: []string{"groupsnapshot.storage.k8s.io"},
+					Resources: []string{"volumegroupsnapshotclasses"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
+				{
+					APIGroups: []string{"groupsnapshot.storage.k8s.io"},
+					Resources: []string{"volumegroupsnapshotcontents"},
+					Verbs:     []string{"get", "list", "watch", "update", "patch"},
+				},
+				{
+					APIGroups: []string{"groupsnapshot.storage.k8s.io"},
+					Resources: []string{"volumegroupsnapshotcontents/status"},
+					Verbs:     []string{"update", "patch"},
+				},
+			},
+		}
+	}
+
+	// snapshotScheduleEditClusterRole allows the users of the shoot to manage snapshot schedules in their namespaces
+	snapshotScheduleEditClusterRole = func() rbac.ClusterRole {
+		return rbac.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "snapshot-schedules-edit",
+				Labels: map[string]string{
+					"rbac.authorization.k8s.io/aggregate-to-admin": "true",
+					"rbac.authorization.k8s.io/aggregate-to-edit":  "true",
+				},
+			},
+			Rules: []rbac.PolicyRule{
+				{
+					APIGroups: []string{storagev1.GroupVersion.Group},
+					Resources: []string{"snapshotschedules"},
+					Verbs:     []string{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"},
+				},
+			},
+		}
+	}
+	snapshotScheduleViewClusterRole = func() rbac.ClusterRole {
+		return rbac.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "snapshot-schedules-view",
+				Labels: map[string]string{
+					"rbac.authorization.k8s.io/aggregate-to-view": "true",
+				},
+			},
+			Rules: []rbac.PolicyRule{
+				{
+					APIGroups: []string{storagev1.GroupVersion.Group},
+					Resources: []string{"snapshotschedules"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
+			},
+		}
+	}
+
+	healthMonitorClusterRole = func() rbac.ClusterRole {
+		return rbac.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "external-health-monitor-controller-runner",
+			},
+			Rules: []rbac.PolicyRule{
+				{
+					APIGroups: []string{""},
+					Resources: []string{"persistentvolumes", "persistentvolumeclaims", "nodes", "pods"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
+				{
+					APIGroups: []string{""},
+					Resources: []string{"events"},
+					Verbs:     []string{"get", "list", "watch", "create", "patch"},
+				},
 			},
 		}
 	}
@@ -324,6 +445,8 @@ var (
 			resizerClusterRole(),
 			snapshotClusterRole(),
 			externalSnapshotterClusterRole(),
+			snapshotScheduleEditClusterRole(),
+			snapshotScheduleViewClusterRole(),
 		}
 	}
 
@@ -424,6 +547,25 @@ var (
 			},
 		}
 	}
+	healthMonitorClusterRoleBinding = func() rbac.ClusterRoleBinding {
+		return rbac.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "csi-external-health-monitor-controller-role",
+			},
+			Subjects: []rbac.Subject{
+				{
+					Kind:      "ServiceAccount",
+					Name:      ctrlServiceAccount().Name,
+					Namespace: ctrlServiceAccount().Namespace,
+				},
+			},
+			RoleRef: rbac.RoleRef{
+				Kind:     "ClusterRole",
+				Name:     healthMonitorClusterRole().Name,
+				APIGroup: healthMonitorClusterRole().APIVersion,
+			},
+		}
+	}
 	clusterRoleBindings = func() []rbac.ClusterRoleBinding {
 		return []rbac.ClusterRoleBinding{
 			nodeClusterRoleBinding(),
@@ -449,6 +591,19 @@ var (
 		},
 	}
 
+	// pluginLivenessProbe restarts a hung csi plugin, the healthz endpoint is served by the liveness-probe sidecar
+	pluginLivenessProbe = func() *corev1.Probe {
+		return &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromString("healthz")},
+			},
+			InitialDelaySeconds: 10,
+			TimeoutSeconds:      3,
+			PeriodSeconds:       10,
+			FailureThreshold:    5,
+		}
+	}
+
 	// Containers
 	csiPluginContainer = corev1.Container{
 		Name:            "lb-csi-plugin",
@@ -464,6 +619,10 @@ var (
 			{Name: "LB_CSI_LOG_FMT", Value: "text"},
 			{Name: "LB_CSI_LOG_TIME", Value: "true"},
 		},
+		Ports: []corev1.ContainerPort{
+			{Name: "healthz", ContainerPort: livenessProbePort, Protocol: corev1.ProtocolTCP},
+		},
+		LivenessProbe: pluginLivenessProbe(),
 		VolumeMounts: []corev1.VolumeMount{
 			{Name: socketDirVolume.Name, MountPath: "/var/lib/csi/sockets/pluginproxy/"},
 			{Name: etcDirVolume.Name, MountPath: "/etc/lb-csi/"},
@@ -480,7 +639,7 @@ var (
 		Name:            "csi-provisioner",
 		Image:           csiProvisionerImage,
 		ImagePullPolicy: corev1.PullIfNotPresent,
-		Args:            []string{"--csi-address=$(ADDRESS)", "--v=4", "--default-fstype=ext4"},
+		Args:            []string{"--csi-address=$(ADDRESS)", "--v=4", "--default-fstype=" + defaultFSType},
 		Env: []corev1.EnvVar{
 			{Name: "ADDRESS", Value: "/var/lib/csi/sockets/pluginproxy/csi.sock"},
 		},
@@ -565,6 +724,42 @@ var (
 			},
 		},
 	}
+	csiHealthMonitorContainer = corev1.Container{
+		Name:            "csi-external-health-monitor-controller",
+		Image:           csiHealthMonitorImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args:            []string{"--csi-address=$(ADDRESS)", "--leader-election=false", "--v=4"},
+		Env: []corev1.EnvVar{
+			{Name: "ADDRESS", Value: "/var/lib/csi/sockets/pluginproxy/csi.sock"},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: socketDirVolume.Name, MountPath: "/var/lib/csi/sockets/pluginproxy/"},
+		},
+		Resources: defaultResourceLimits,
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: new(false),
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+			},
+		},
+	}
+	// livenessProbeContainer serves the healthz endpoint which checks the csi plugin with a probe call
+	livenessProbeContainer = corev1.Container{
+		Name:            "liveness-probe",
+		Image:           livenessProbeImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args:            []string{"--csi-address=/var/lib/csi/sockets/pluginproxy/csi.sock", fmt.Sprintf("--health-port=%d", livenessProbePort)},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: socketDirVolume.Name, MountPath: "/var/lib/csi/sockets/pluginproxy/"},
+		},
+		Resources: defaultResourceLimits,
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: new(false),
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+			},
+		},
+	}
 	discoveryClientContainer = corev1.Container{
 		Name:            "lb-nvme-discovery-client",
 		Image:           lbDiscoveryClientImage,
@@ -618,6 +813,10 @@ var (
 			{Name: "LB_CSI_LOG_FMT", Value: "text"},
 			{Name: "LB_CSI_LOG_TIME", Value: "true"},
 		},
+		Ports: []corev1.ContainerPort{
+			{Name: "healthz", ContainerPort: nodeLivenessProbePort, Protocol: corev1.ProtocolTCP},
+		},
+		LivenessProbe: pluginLivenessProbe(),
 		VolumeMounts: []corev1.VolumeMount{
 			{Name: pluginDirVolume.Name, MountPath: "/csi"},
 			{Name: podsMountDirVolume.Name, MountPath: "/var/lib/kubelet", MountPropagation: &mountPropagationBidirectional},
@@ -628,6 +827,24 @@ var (
 		Resources: defaultResourceLimits,
 	}
 
+	// nodeLivenessProbeContainer uses a different port than the controller, the node pods run in the host network
+	nodeLivenessProbeContainer = corev1.Container{
+		Name:            "liveness-probe",
+		Image:           livenessProbeImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args:            []string{"--csi-address=/csi/csi.sock", fmt.Sprintf("--health-port=%d", nodeLivenessProbePort)},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: pluginDirVolume.Name, MountPath: "/csi"},
+		},
+		Resources: defaultResourceLimits,
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: new(false),
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+			},
+		},
+	}
+
 	csiNodeDriverRegistrarContainer = corev1.Container{
 		Name:            "csi-node-driver-registrar",
 		Image:           csiNodeDriverRegistrarImage,
@@ -751,6 +968,7 @@ var (
 						csiPluginNodeContainer,
 						csiNodeDriverRegistrarContainer,
 						discoveryClientContainer,
+						nodeLivenessProbeContainer,
 					},
 					ServiceAccountName: nodeServiceAccount().Name,
 					PriorityClassName:  "system-node-critical",
@@ -781,17 +999,27 @@ var (
 	}
 )
 
-func (r *DurosReconciler) reconcileStorageClassSecret(ctx context.Context, credential *durosv2.Credential, adminKey []byte) error {
+func (r *DurosReconciler) reconcileStorageClassSecret(ctx context.Context, duros *storagev1.Duros, b *Backend, credential *durosv2.Credential) error {
 	var (
-		log    = r.Log.WithName("storage-class")
+		log    = r.Log.WithName("storage-class").WithValues("backend", b.Name)
 		secret = &corev1.Secret{}
 	)
 
-	key := types.NamespacedName{Name: storageClassCredentialsRef, Namespace: namespace}
+	// issue deploys a new token and records it on the duros resource
+	issue := func(reason, message string) error {
+		err := r.deployStorageClassSecret(ctx, log, b, credential)
+		if err != nil {
+			return err
+		}
+		r.Recorder.Eventf(duros, corev1.EventTypeNormal, reason, "%s for backend %s", message, b.Name)
+		return nil
+	}
+
+	key := types.NamespacedName{Name: b.credentialsRef(), Namespace: namespace}
 	err := r.Shoot.Get(ctx, key, secret)
 	if err != nil && apierrors.IsNotFound(err) {
 		log.Info("deploy storage-class-secret")
-		return r.deployStorageClassSecret(ctx, log, credential, adminKey)
+		return issue("TokenIssued", "issued storage class token")
 	}
 	if err != nil {
 		return fmt.Errorf("unable to read secret: %w", err)
@@ -808,7 +1036,7 @@ func (r *DurosReconciler) reconcileStorageClassSecret(ctx context.Context, crede
 		if err != nil {
 			return err
 		}
-		return r.deployStorageClassSecret(ctx, log, credential, adminKey)
+		return issue("TokenIssued", "reissued storage class token, the existing secret contained no token")
 	}
 
 	claims := &jwt.RegisteredClaims{}
@@ -822,13 +1050,15 @@ func (r *DurosReconciler) reconcileStorageClassSecret(ctx context.Context, crede
 		if err != nil {
 			return err
 		}
-		return r.deployStorageClassSecret(ctx, log, credential, adminKey)
+		return issue("TokenIssued", "reissued storage class token, the existing token was not parsable")
 	}
 
+	tokenExpiry.WithLabelValues(r.Namespace, b.Name).Set(float64(claims.ExpiresAt.Unix()))
+
 	renewalAt := claims.ExpiresAt.Add(-tokenRenewalBefore)
 	if time.Now().After(renewalAt) {
 		log.Info("storage class token is expiring soon, refreshing token", "expires-at", claims.ExpiresAt.String())
-		return r.deployStorageClassSecret(ctx, log, credential, adminKey)
+		return issue("TokenRenewed", "renewed storage class token expiring at "+claims.ExpiresAt.String())
 	}
 
 	log.Info("storage class token is not expiring soon, not doing anything", "expires-at", claims.ExpiresAt.String(), "renewal-at", renewalAt.String())
@@ -836,19 +1066,20 @@ func (r *DurosReconciler) reconcileStorageClassSecret(ctx context.Context, crede
 	return nil
 }
 
-func (r *DurosReconciler) deployStorageClassSecret(ctx context.Context, log logr.Logger, credential *durosv2.Credential, adminKey []byte) error {
-	key, err := extract(adminKey)
+func (r *DurosReconciler) deployStorageClassSecret(ctx context.Context, log logr.Logger, b *Backend, credential *durosv2.Credential) error {
+	key, err := extract(b.AdminKey)
 	if err != nil {
 		return err
 	}
 
+	expiresAt := time.Now().Add(tokenLifetime)
 	token, err := duros.NewJWTTokenForCredential(r.Namespace, "duros-controller", credential, []string{credential.GetProjectName() + ":admin"}, tokenLifetime, key)
 	if err != nil {
 		return fmt.Errorf("unable to create jwt token:%w", err)
 	}
 
 	storageClassSecret := corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{Name: storageClassCredentialsRef, Namespace: namespace},
+		ObjectMeta: metav1.ObjectMeta{Name: b.credentialsRef(), Namespace: namespace},
 	}
 
 	op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, &storageClassSecret, func() error {
@@ -863,12 +1094,13 @@ func (r *DurosReconciler) deployStorageClassSecret(ctx context.Context, log logr
 		return err
 	}
 
-	log.Info("storageclasssecret", "name", storageClassCredentialsRef, "operation", op)
+	tokenExpiry.WithLabelValues(r.Namespace, b.Name).Set(float64(expiresAt.Unix()))
+	log.Info("storageclasssecret", "name", storageClassSecret.Name, "operation", op)
 
 	return nil
 }
 
-func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs []storagev1.StorageClass) error {
+func (r *DurosReconciler) deployCSI(ctx context.Context, duros *storagev1.Duros, projectID string, scs []storagev1.StorageClass, snapshotClasses []storagev1.SnapshotClass, attributesClasses []storagev1.VolumeAttributesClass, images imageSet, features features) error {
 	log := r.Log.WithName("storage-csi")
 	log.Info("deploy storage-class")
 
@@ -883,13 +1115,24 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 	log.Info("sc supported", "group", gkv.Group, "kind", gkv.Resource, "version", gkv.Version)
 
 	snapshotsSupported := false
+	groupSnapshotsSupported := false
+	var (
+		attributesClassesVersion   schema.GroupVersion
+		attributesClassesSupported bool
+	)
 	switch gkv.Version {
 	case "v1":
+		// capacity is only published in the shoot if csistoragecapacities are served in v1,
+		// otherwise the scheduler would wait forever for capacity information
+		_, err := rm.KindFor(storage.SchemeGroupVersion.WithResource("csistoragecapacities"))
+		capacitySupported := err == nil
+
 		csiDriver := &storage.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: provisioner}}
 		op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, csiDriver, func() error {
 			csiDriver.Spec = storage.CSIDriverSpec{
-				AttachRequired: new(true),
-				PodInfoOnMount: new(true),
+				AttachRequired:  new(true),
+				PodInfoOnMount:  new(true),
+				StorageCapacity: new(capacitySupported),
 			}
 			return nil
 		})
@@ -897,22 +1140,21 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 			return err
 		}
 		log.Info("csidriver", "name", csiDriver.Name, "operation", op)
-		snapshotsSupported = true
-		snapshotControllerContainer.Image = snapshotControllerImage
-		csiSnapshotterContainer.Image = csiSnapshotterImage
-	case "v1beta1":
-		csiDriver := &storagev1beta1.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: provisioner}}
-		op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, csiDriver, func() error {
-			csiDriver.Spec = storagev1beta1.CSIDriverSpec{
-				AttachRequired: new(true),
-				PodInfoOnMount: new(true),
-			}
-			return nil
-		})
+
+		// a failure must not remove the snapshot components, they would be deployed again on the next reconciliation
+		snapshotsSupported, err = r.reconcileSnapshotCRDs(ctx, volumeSnapshotCRDs)
 		if err != nil {
 			return err
 		}
-		log.Info("csidriver", "name", csiDriver.Name, "operation", op)
+		if snapshotsSupported && features.groupSnapshots {
+			groupSnapshotsSupported, err = r.reconcileSnapshotCRDs(ctx, volumeGroupSnapshotCRDs)
+			if err != nil {
+				return err
+			}
+		}
+		if features.volumeAttributesClasses {
+			attributesClassesVersion, attributesClassesSupported = volumeAttributesClassVersion(rm)
+		}
 	default:
 		err := fmt.Errorf("unsupported csi driver version:%s", gkv.Version)
 		log.Error(err, "no csi plugin deployment possible")
@@ -935,6 +1177,10 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 		cr := clusterRoles()[i]
 		obj := &rbac.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: cr.Name, Namespace: cr.Namespace}}
 		op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, obj, func() error {
+			if cr.Labels != nil {
+				// aggregation labels
+				obj.Labels = cr.Labels
+			}
 			obj.Rules = cr.Rules
 			return nil
 		})
@@ -958,30 +1204,47 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 		log.Info("clusterrolebindinding", "name", crb.Name, "operation", op)
 	}
 
+	err = r.reconcileHealthMonitorRBAC(ctx)
+	if err != nil {
+		return err
+	}
+
 	sts := &apps.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      lbCSIControllerName,
 			Namespace: namespace,
 		},
 	}
-	op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, sts, func() error {
-		controllerRoleLabels := map[string]string{
-			"app":                                    "lb-csi-plugin",
-			"role":                                   "controller",
-			"gardener.cloud/role":                    "system-component",
-			"networking.gardener.cloud/to-apiserver": "allowed",
-			"networking.gardener.cloud/to-dns":       "allowed",
-		}
-		containers := []corev1.Container{
-			csiPluginContainer,
-			csiProvisionerContainer,
-			csiAttacherContainer,
-			csiResizerContainer,
-		}
-		if snapshotsSupported {
-			containers = append(containers, snapshotControllerContainer, csiSnapshotterContainer)
-		}
+	controllerRoleLabels := map[string]string{
+		"app":                                    "lb-csi-plugin",
+		"role":                                   "controller",
+		"gardener.cloud/role":                    "system-component",
+		"networking.gardener.cloud/to-apiserver": "allowed",
+		"networking.gardener.cloud/to-dns":       "allowed",
+	}
+	containers := []corev1.Container{
+		csiPluginContainer,
+		csiProvisionerContainer,
+		csiAttacherContainer,
+		csiResizerContainer,
+		livenessProbeContainer,
+	}
+	if r.VolumeHealthMonitor {
+		containers = append(containers, csiHealthMonitorContainer)
+	}
+	if snapshotsSupported {
+		containers = append(containers, snapshotControllerContainer, csiSnapshotterContainer)
+	}
+	containers = images.apply(containers)
+	if groupSnapshotsSupported {
+		appendArgs(containers, "--feature-gates=CSIVolumeGroupSnapshot=true", snapshotControllerContainer.Name, csiSnapshotterContainer.Name)
+	}
+	if attributesClassesSupported {
+		appendArgs(containers, "--feature-gates=VolumeAttributesClass=true", csiProvisionerContainer.Name, csiResizerContainer.Name)
+	}
+	metricsContainers(containers)
 
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, sts, func() error {
 		sts.Labels = map[string]string{
 			// cannot be used as we don't have a deletion flow
 			// https://github.com/metal-stack/duros-controller/pull/28
@@ -994,7 +1257,7 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{Labels: controllerRoleLabels},
 				Spec: corev1.PodSpec{
-					Containers:         containers,
+					Containers:         slices.Clone(containers),
 					ServiceAccountName: ctrlServiceAccount().Name,
 					PriorityClassName:  "system-cluster-critical",
 					SecurityContext: &corev1.PodSecurityContext{
@@ -1021,6 +1284,7 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 			}
 
 			log.Info("recreated statefulset", "name", sts.Name)
+			r.Recorder.Eventf(duros, corev1.EventTypeNormal, "StatefulSetRecreated", "deleted statefulset %s in the shoot for recreation: %s", sts.Name, err)
 		}
 
 		return fmt.Errorf("error creating or updating statefulset: %w", err)
@@ -1028,6 +1292,11 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 
 	log.Info("statefulset", "name", sts.Name, "operation", op)
 
+	err = r.deployControllerMetrics(ctx, containers, controllerRoleLabels)
+	if err != nil {
+		return err
+	}
+
 	ds := &apps.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: csiNodeDaemonSet.Name, Namespace: csiNodeDaemonSet.Namespace}}
 	op, err = controllerutil.CreateOrUpdate(ctx, r.Shoot, ds, func() error {
 		ds.Labels = map[string]string{
@@ -1036,7 +1305,9 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 			// "shoot.gardener.cloud/no-cleanup":        "true",
 			"node.gardener.cloud/critical-component": "true",
 		}
-		ds.Spec = csiNodeDaemonSet.Spec
+		ds.Spec = *csiNodeDaemonSet.Spec.DeepCopy()
+		ds.Spec.Template.Spec.InitContainers = images.apply(ds.Spec.Template.Spec.InitContainers)
+		ds.Spec.Template.Spec.Containers = images.apply(ds.Spec.Template.Spec.Containers)
 		return nil
 	})
 	if err != nil {
@@ -1046,6 +1317,12 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 
 	for i := range scs {
 		sc := scs[i]
+		b, err := r.backend(sc.Backend)
+		if err != nil {
+			return err
+		}
+		credentialsRef := b.credentialsRef()
+
 		annotations := map[string]string{
 			"storageclass.kubernetes.io/is-default-class": strconv.FormatBool(sc.Default),
 			metalClusterDescriptionTag:                    durosDoNotEditMessage,
@@ -1059,18 +1336,18 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 			obj.Parameters = map[string]string{
 				"mgmt-scheme":   "grpcs",
 				"compression":   "disabled",
-				"mgmt-endpoint": r.Endpoints,
+				"mgmt-endpoint": b.mgmtEndpoints(),
 				"project-name":  projectID,
 				"replica-count": strconv.Itoa(sc.ReplicaCount),
-				"csi.storage.k8s.io/controller-expand-secret-name":       storageClassCredentialsRef,
+				"csi.storage.k8s.io/controller-expand-secret-name":       credentialsRef,
 				"csi.storage.k8s.io/controller-expand-secret-namespace":  namespace,
-				"csi.storage.k8s.io/controller-publish-secret-name":      storageClassCredentialsRef,
+				"csi.storage.k8s.io/controller-publish-secret-name":      credentialsRef,
 				"csi.storage.k8s.io/controller-publish-secret-namespace": namespace,
-				"csi.storage.k8s.io/node-publish-secret-name":            storageClassCredentialsRef,
+				"csi.storage.k8s.io/node-publish-secret-name":            credentialsRef,
 				"csi.storage.k8s.io/node-publish-secret-namespace":       namespace,
-				"csi.storage.k8s.io/node-stage-secret-name":              storageClassCredentialsRef,
+				"csi.storage.k8s.io/node-stage-secret-name":              credentialsRef,
 				"csi.storage.k8s.io/node-stage-secret-namespace":         namespace,
-				"csi.storage.k8s.io/provisioner-secret-name":             storageClassCredentialsRef,
+				"csi.storage.k8s.io/provisioner-secret-name":             credentialsRef,
 				"csi.storage.k8s.io/provisioner-secret-namespace":        namespace,
 			}
 
@@ -1094,33 +1371,98 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 		if err != nil {
 			// if error is of type Invalid, delete old storage class. Will be recreated immediately on next reconciliation
 			if apierrors.IsInvalid(err) {
-				err := r.Shoot.Delete(ctx, obj)
-				if err != nil {
-					return err
+				deleteErr := r.Shoot.Delete(ctx, obj)
+				if deleteErr != nil {
+					return deleteErr
 				}
 				log.Info("storageclass", "name", sc.Name, "operation", "deleted")
+				r.Recorder.Eventf(duros, corev1.EventTypeNormal, "StorageClassRecreated", "deleted storageclass %s in the shoot for recreation: %s", sc.Name, err)
 			}
 			return err
 		}
 
 		log.Info("storageclass", "name", sc.Name, "operation", op)
+	}
+
+	if snapshotsSupported {
+		err = r.deploySnapshotClasses(ctx, snapshotClasses, groupSnapshotsSupported)
+		if err != nil {
+			return err
+		}
+		err = r.reconcileSnapshotSchedules(ctx)
+		if err != nil {
+			return err
+		}
+	}
 
-		// Snapshot Volume Class
-		snapannotations := map[string]string{
-			"snapshot.storage.kubernetes.io/is-default-class": "true",
-			metalClusterDescriptionTag:                        durosDoNotEditMessage,
+	switch {
+	case attributesClassesSupported:
+		err = r.deployVolumeAttributesClasses(ctx, duros, attributesClassesVersion, attributesClasses)
+		if err != nil {
+			return err
 		}
-		snapobj := &snapshotv1.VolumeSnapshotClass{ObjectMeta: metav1.ObjectMeta{Name: "partition-snapshot"}}
+	case len(attributesClasses) > 0:
+		log.Info("volumeattributesclasses are not supported by the shoot, not deploying them")
+		meta.SetStatusCondition(&duros.Status.Conditions, metav1.Condition{
+			Type:               storagev1.ConditionVolumeAttributesClassesReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             "Unsupported",
+			Message:            "volumeattributesclasses are not supported by the csi images or not served by the shoot",
+			ObservedGeneration: duros.Generation,
+		})
+	default:
+		meta.RemoveStatusCondition(&duros.Status.Conditions, storagev1.ConditionVolumeAttributesClassesReady)
+	}
+
+	return nil
+}
+
+// defaultSnapshotClasses are deployed if no snapshot classes are configured
+var defaultSnapshotClasses = []storagev1.SnapshotClass{
+	{
+		Name:           "partition-snapshot",
+		DeletionPolicy: string(snapshotv1.VolumeSnapshotContentDelete),
+		Default:        true,
+	},
+}
+
+// deploySnapshotClasses creates or updates the given volumesnapshotclasses and deletes all other volumesnapshotclasses of the lightbits driver.
+// If group snapshots are supported, a volumegroupsnapshotclass is deployed for every volumesnapshotclass as well.
+func (r *DurosReconciler) deploySnapshotClasses(ctx context.Context, snapshotClasses []storagev1.SnapshotClass, groupSnapshots bool) error {
+	log := r.Log.WithName("storage-csi")
+
+	if len(snapshotClasses) == 0 {
+		snapshotClasses = defaultSnapshotClasses
+	}
+
+	desired := map[string]bool{}
+	for _, sc := range snapshotClasses {
+		b, err := r.backend(sc.Backend)
+		if err != nil {
+			return err
+		}
+		credentialsRef := b.credentialsRef()
+
+		deletionPolicy := snapshotv1.VolumeSnapshotContentDelete
+		if sc.DeletionPolicy != "" {
+			deletionPolicy = snapshotv1.DeletionPolicy(sc.DeletionPolicy)
+		}
+
+		desired[sc.Name] = true
+		snapobj := &snapshotv1.VolumeSnapshotClass{ObjectMeta: metav1.ObjectMeta{Name: sc.Name}}
 		op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, snapobj, func() error {
-			snapobj.Annotations = snapannotations
+			mergeAnnotations(snapobj, map[string]string{
+				"snapshot.storage.kubernetes.io/is-default-class": strconv.FormatBool(sc.Default),
+				metalClusterDescriptionTag:                        durosDoNotEditMessage,
+			})
 			snapobj.Driver = provisioner
-			snapobj.DeletionPolicy = snapshotv1.VolumeSnapshotContentDelete
+			snapobj.DeletionPolicy = deletionPolicy
 			snapobj.Parameters = map[string]string{
-				"csi.storage.k8s.io/snapshotter-secret-name":               storageClassCredentialsRef,
+				"csi.storage.k8s.io/snapshotter-secret-name":               credentialsRef,
 				"csi.storage.k8s.io/snapshotter-secret-namespace":          namespace,
-				"csi.storage.k8s.io/snapshotter-list-secret-name":          storageClassCredentialsRef,
+				"csi.storage.k8s.io/snapshotter-list-secret-name":          credentialsRef,
 				"csi.storage.k8s.io/snapshotter-list-secret-namespace":     namespace,
-				"snapshot.storage.kubernetes.io/deletion-secret-name":      storageClassCredentialsRef,
+				"snapshot.storage.kubernetes.io/deletion-secret-name":      credentialsRef,
 				"snapshot.storage.kubernetes.io/deletion-secret-namespace": namespace,
 			}
 			return nil
@@ -1130,11 +1472,175 @@ func (r *DurosReconciler) deployCSI(ctx context.Context, projectID string, scs [
 		}
 		log.Info("snapshotstorageclass", "name", snapobj.Name, "operation", op)
 
+		if groupSnapshots {
+			err = r.deployGroupSnapshotClass(ctx, sc, deletionPolicy, credentialsRef)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	existing := &snapshotv1.VolumeSnapshotClassList{}
+	err := r.Shoot.List(ctx, existing)
+	if err != nil {
+		return fmt.Errorf("unable to list volumesnapshotclasses: %w", err)
+	}
+	for i := range existing.Items {
+		snapobj := &existing.Items[i]
+		// snapshot classes of the tenant for the lightbits driver are kept
+		if snapobj.Driver != provisioner || !isManaged(snapobj) || desired[snapobj.Name] {
+			continue
+		}
+		err = r.Shoot.Delete(ctx, snapobj)
+		if client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to delete volumesnapshotclass %s: %w", snapobj.Name, err)
+		}
+		log.Info("snapshotstorageclass", "name", snapobj.Name, "operation", "deleted")
 	}
 
+	// group snapshot classes are also deleted when group snapshots are disabled
+	return r.pruneGroupSnapshotClasses(ctx, desired, groupSnapshots)
+}
+
+// reconcileHealthMonitorRBAC deploys the clusterrole and clusterrolebinding of the csi external-health-monitor-controller
+// if the volume health monitor is enabled and deletes them otherwise
+func (r *DurosReconciler) reconcileHealthMonitorRBAC(ctx context.Context) error {
+	log := r.Log.WithName("storage-csi")
+
+	cr := healthMonitorClusterRole()
+	crb := healthMonitorClusterRoleBinding()
+	if !r.VolumeHealthMonitor {
+		for kind, obj := range map[string]client.Object{
+			"clusterrolebinding": &rbac.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: crb.Name}},
+			"clusterrole":        &rbac.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: cr.Name}},
+		} {
+			err := r.Shoot.Delete(ctx, obj)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to delete %s %s: %w", kind, obj.GetName(), err)
+			}
+			log.Info(kind, "name", obj.GetName(), "operation", "deleted")
+		}
+		return nil
+	}
+
+	role := &rbac.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: cr.Name}}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, role, func() error {
+		role.Rules = cr.Rules
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("clusterrole", "name", cr.Name, "operation", op)
+
+	binding := &rbac.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: crb.Name}}
+	op, err = controllerutil.CreateOrUpdate(ctx, r.Shoot, binding, func() error {
+		binding.Subjects = crb.Subjects
+		binding.RoleRef = crb.RoleRef
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("clusterrolebinding", "name", crb.Name, "operation", op)
 	return nil
 }
 
+// pruneGroupSnapshotClasses deletes the volumegroupsnapshotclasses deployed by this controller which are not desired,
+// all of them if group snapshots are disabled. Nothing is done if the group snapshot api is not served.
+func (r *DurosReconciler) pruneGroupSnapshotClasses(ctx context.Context, desired map[string]bool, groupSnapshots bool) error {
+	log := r.Log.WithName("storage-csi")
+
+	existing := &unstructured.UnstructuredList{}
+	existing.SetGroupVersionKind(volumeGroupSnapshotClassGVK.GroupVersion().WithKind("VolumeGroupSnapshotClassList"))
+	err := r.Shoot.List(ctx, existing)
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to list volumegroupsnapshotclasses: %w", err)
+	}
+	for i := range existing.Items {
+		obj := &existing.Items[i]
+		driver, _, _ := unstructured.NestedString(obj.Object, "driver")
+		if driver != provisioner || !isManaged(obj) || (groupSnapshots && desired[obj.GetName()]) {
+			continue
+		}
+		err = r.Shoot.Delete(ctx, obj)
+		if client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to delete volumegroupsnapshotclass %s: %w", obj.GetName(), err)
+		}
+		log.Info("volumegroupsnapshotclass", "name", obj.GetName(), "operation", "deleted")
+	}
+	return nil
+}
+
+// volumeGroupSnapshotClassGVK is used with unstructured objects, the snapshot client of this module does not contain the group snapshot api
+var volumeGroupSnapshotClassGVK = schema.GroupVersionKind{Group: "groupsnapshot.storage.k8s.io", Version: "v1beta2", Kind: "VolumeGroupSnapshotClass"}
+
+// deployGroupSnapshotClass creates or updates the volumegroupsnapshotclass for the given snapshot class
+func (r *DurosReconciler) deployGroupSnapshotClass(ctx context.Context, sc storagev1.SnapshotClass, deletionPolicy snapshotv1.DeletionPolicy, credentialsRef string) error {
+	log := r.Log.WithName("storage-csi")
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(volumeGroupSnapshotClassGVK)
+	obj.SetName(sc.Name)
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, obj, func() error {
+		mergeAnnotations(obj, map[string]string{
+			"groupsnapshot.storage.kubernetes.io/is-default-class": strconv.FormatBool(sc.Default),
+			metalClusterDescriptionTag:                             durosDoNotEditMessage,
+		})
+		obj.Object["driver"] = provisioner
+		obj.Object["deletionPolicy"] = string(deletionPolicy)
+		obj.Object["parameters"] = map[string]any{
+			"csi.storage.k8s.io/group-snapshotter-secret-name":      credentialsRef,
+			"csi.storage.k8s.io/group-snapshotter-secret-namespace": namespace,
+		}
+		return nil
+	})
+	if err != nil {
+		// driver, deletion policy and parameters are immutable, recreated on the next reconciliation
+		if apierrors.IsInvalid(err) {
+			deleteErr := r.Shoot.Delete(ctx, obj)
+			if deleteErr != nil {
+				return deleteErr
+			}
+			log.Info("volumegroupsnapshotclass", "name", sc.Name, "operation", "deleted")
+		}
+		return err
+	}
+	log.Info("volumegroupsnapshotclass", "name", sc.Name, "operation", op)
+	return nil
+}
+
+// mergeAnnotations sets the given annotations on the object and keeps the annotations set by others
+func mergeAnnotations(obj metav1.Object, annotations map[string]string) {
+	merged := obj.GetAnnotations()
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	maps.Copy(merged, annotations)
+	obj.SetAnnotations(merged)
+}
+
+// isManaged returns true if the object was created by this controller
+func isManaged(obj metav1.Object) bool {
+	_, ok := obj.GetAnnotations()[metalClusterDescriptionTag]
+	return ok
+}
+
+// appendArgs appends the argument to the containers with the given names
+func appendArgs(containers []corev1.Container, arg string, names ...string) {
+	for i := range containers {
+		if slices.Contains(names, containers[i].Name) {
+			containers[i].Args = append(containers[i].Args, arg)
+		}
+	}
+}
+
 type deletionResource struct {
 	Key    types.NamespacedName
 	Object client.Object
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+// newFakeClient returns a client with the given objects which knows the apis used in the seed and the shoot
+func newFakeClient(objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(snapshotv1.AddToScheme(scheme))
+	utilruntime.Must(storagev1.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+	scheme.AddKnownTypeWithName(volumeGroupSnapshotClassGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(volumeGroupSnapshotClassGVK.GroupVersion().WithKind("VolumeGroupSnapshotClassList"), &unstructured.UnstructuredList{})
+	scheme.AddKnownTypeWithName(prometheusRuleGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(prometheusRuleGVK.GroupVersion().WithKind("PrometheusRuleList"), &unstructured.UnstructuredList{})
+	scheme.AddKnownTypeWithName(serviceMonitorGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(serviceMonitorGVK.GroupVersion().WithKind("ServiceMonitorList"), &unstructured.UnstructuredList{})
+	// the v1 volumeattributesclass types are not contained in the api module yet
+	for _, gv := range volumeAttributesClassVersions {
+		if !scheme.Recognizes(gv.WithKind("VolumeAttributesClass")) {
+			scheme.AddKnownTypeWithName(gv.WithKind("VolumeAttributesClass"), &unstructured.Unstructured{})
+			scheme.AddKnownTypeWithName(gv.WithKind("VolumeAttributesClassList"), &unstructured.UnstructuredList{})
+		}
+	}
+	// the field selectors on events the apiserver supports
+	eventIndex := func(field func(e *corev1.Event) string) client.IndexerFunc {
+		return func(obj client.Object) []string {
+			return []string{field(obj.(*corev1.Event))}
+		}
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+		WithIndex(&corev1.Event{}, eventInvolvedObjectKindField, eventIndex(func(e *corev1.Event) string { return e.InvolvedObject.Kind })).
+		WithIndex(&corev1.Event{}, eventReasonField, eventIndex(func(e *corev1.Event) string { return e.Reason })).
+		Build()
+}
+
+func TestDeploySnapshotClasses(t *testing.T) {
+	managed := map[string]string{metalClusterDescriptionTag: durosDoNotEditMessage}
+	shoot := newFakeClient(
+		&snapshotv1.VolumeSnapshotClass{ObjectMeta: metav1.ObjectMeta{Name: "obsolete", Annotations: managed}, Driver: provisioner},
+		&snapshotv1.VolumeSnapshotClass{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}, Driver: provisioner},
+		&snapshotv1.VolumeSnapshotClass{ObjectMeta: metav1.ObjectMeta{Name: "other-driver", Annotations: managed}, Driver: "other.csi.k8s.io"},
+		&snapshotv1.VolumeSnapshotClass{ObjectMeta: metav1.ObjectMeta{Name: "partition-snapshot", Annotations: map[string]string{"team": "storage"}}, Driver: provisioner},
+	)
+	r := &DurosReconciler{
+		Log:      logr.Discard(),
+		Shoot:    shoot,
+		Backends: map[string]*Backend{DefaultBackend: {Name: DefaultBackend}},
+	}
+
+	err := r.deploySnapshotClasses(context.Background(), []storagev1.SnapshotClass{{Name: "partition-snapshot", Default: true}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	classes := &snapshotv1.VolumeSnapshotClassList{}
+	err = shoot.List(context.Background(), classes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range classes.Items {
+		names = append(names, c.Name)
+		if c.Name == "partition-snapshot" {
+			if c.Annotations["team"] != "storage" || c.Annotations["snapshot.storage.kubernetes.io/is-default-class"] != "true" {
+				t.Errorf("annotations = %v, want the annotations merged", c.Annotations)
+			}
+		}
+	}
+	slices.Sort(names)
+	if want := []string{"other-driver", "partition-snapshot", "tenant"}; !slices.Equal(names, want) {
+		t.Errorf("snapshot classes = %v, want %v", names, want)
+	}
+}
+
+func TestPruneGroupSnapshotClasses(t *testing.T) {
+	groupSnapshotClass := func(name string, managed bool) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]any{"driver": provisioner, "deletionPolicy": "Delete"}}
+		obj.SetGroupVersionKind(volumeGroupSnapshotClassGVK)
+		obj.SetName(name)
+		if managed {
+			obj.SetAnnotations(map[string]string{metalClusterDescriptionTag: durosDoNotEditMessage})
+		}
+		return obj
+	}
+	tests := []struct {
+		name           string
+		groupSnapshots bool
+		want           []string
+	}{
+		{
+			name:           "obsolete classes are deleted",
+			groupSnapshots: true,
+			want:           []string{"partition-snapshot", "tenant"},
+		},
+		{
+			name:           "all managed classes are deleted if group snapshots are disabled",
+			groupSnapshots: false,
+			want:           []string{"tenant"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shoot := newFakeClient(
+				groupSnapshotClass("partition-snapshot", true),
+				groupSnapshotClass("obsolete", true),
+				groupSnapshotClass("tenant", false),
+			)
+			r := &DurosReconciler{Log: logr.Discard(), Shoot: shoot}
+
+			err := r.pruneGroupSnapshotClasses(context.Background(), map[string]bool{"partition-snapshot": true}, tt.groupSnapshots)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			classes := &unstructured.UnstructuredList{}
+			classes.SetGroupVersionKind(volumeGroupSnapshotClassGVK.GroupVersion().WithKind("VolumeGroupSnapshotClassList"))
+			err = shoot.List(context.Background(), classes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, c := range classes.Items {
+				names = append(names, c.GetName())
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("group snapshot classes = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileHealthMonitorRBAC(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%t", enabled), func(t *testing.T) {
+			ctx := context.Background()
+			role, binding := healthMonitorClusterRole(), healthMonitorClusterRoleBinding()
+			shoot := newFakeClient(&role, &binding)
+			r := &DurosReconciler{Log: logr.Discard(), Shoot: shoot, VolumeHealthMonitor: enabled}
+
+			err := r.reconcileHealthMonitorRBAC(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// deleting again must not fail
+			err = r.reconcileHealthMonitorRBAC(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, obj := range []client.Object{&rbacv1.ClusterRole{}, &rbacv1.ClusterRoleBinding{}} {
+				name := role.Name
+				if _, ok := obj.(*rbacv1.ClusterRoleBinding); ok {
+					name = binding.Name
+				}
+				err := shoot.Get(ctx, client.ObjectKey{Name: name}, obj)
+				if exists := err == nil; exists != enabled {
+					t.Errorf("%s exists = %t, want %t: %v", name, exists, enabled, err)
+				}
+			}
+		})
+	}
+}
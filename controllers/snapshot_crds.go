@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// snapshotCRDVersion is the release of the external-snapshotter the embedded crds are taken from,
+	// it is the release of the snapshotControllerImage and the csiSnapshotterImage
+	snapshotCRDVersion = externalSnapshotterVersion
+	// snapshotCRDVersionAnnotation marks the crds installed by this controller with their version
+	snapshotCRDVersionAnnotation = "storage.metal-stack.io/snapshot-crd-version"
+)
+
+const (
+	volumeSnapshotCRDs      = "crds/snapshot"
+	volumeGroupSnapshotCRDs = "crds/groupsnapshot"
+)
+
+//go:embed crds/snapshot/*.yaml crds/groupsnapshot/*.yaml
+var snapshotCRDs embed.FS
+
+// reconcileSnapshotCRDs installs the crds of the given directory, volumeSnapshotCRDs or volumeGroupSnapshotCRDs, if they are missing in the shoot
+// and upgrades the crds installed by this controller. Crds installed by someone else are not touched.
+// It returns true if all crds are established and can be used.
+func (r *DurosReconciler) reconcileSnapshotCRDs(ctx context.Context, dir string) (bool, error) {
+	log := r.Log.WithName("snapshot-crds")
+
+	crds, err := embeddedCRDs(snapshotCRDs, dir)
+	if err != nil {
+		return false, err
+	}
+
+	established := true
+	for _, crd := range crds {
+		crd.Annotations[snapshotCRDVersionAnnotation] = snapshotCRDVersion
+		existing := &apiextensionsv1.CustomResourceDefinition{}
+		err := r.Shoot.Get(ctx, types.NamespacedName{Name: crd.Name}, existing)
+		if apierrors.IsNotFound(err) {
+			err = r.Shoot.Create(ctx, crd)
+			if err != nil {
+				return false, fmt.Errorf("unable to create crd %s: %w", crd.Name, err)
+			}
+			log.Info("crd", "name", crd.Name, "version", snapshotCRDVersion, "operation", "created")
+			// it takes a moment until the crd is served, snapshots are used on the next reconciliation
+			established = false
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("unable to get crd %s: %w", crd.Name, err)
+		}
+
+		if version, ok := existing.Annotations[snapshotCRDVersionAnnotation]; ok && version != snapshotCRDVersion {
+			for k, v := range crd.Annotations {
+				metav1.SetMetaDataAnnotation(&existing.ObjectMeta, k, v)
+			}
+			existing.Spec = crd.Spec
+			err = r.Shoot.Update(ctx, existing)
+			if err != nil {
+				return false, fmt.Errorf("unable to update crd %s: %w", crd.Name, err)
+			}
+			log.Info("crd", "name", crd.Name, "from", version, "to", snapshotCRDVersion, "operation", "updated")
+		}
+
+		if !isEstablished(existing) {
+			established = false
+		}
+	}
+	return established, nil
+}
+
+// embeddedCRDs reads all crds from the given directory
+func embeddedCRDs(fs embed.FS, dir string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []*apiextensionsv1.CustomResourceDefinition
+	for _, e := range entries {
+		raw, err := fs.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		err = yaml.Unmarshal(raw, crd)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse crd %s: %w", e.Name(), err)
+		}
+		if crd.Annotations == nil {
+			crd.Annotations = map[string]string{}
+		}
+		crd.Annotations[metalClusterDescriptionTag] = durosDoNotEditMessage
+		result = append(result, crd)
+	}
+	return result, nil
+}
+
+func isEstablished(crd *apiextensionsv1.CustomResourceDefinition) bool {
+	for _, c := range crd.Status.Conditions {
+		if c.Type == apiextensionsv1.Established {
+			return c.Status == apiextensionsv1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+// snapshotScheduleLabel references the schedule which created a volume snapshot
+const snapshotScheduleLabel = "storage.metal-stack.io/snapshot-schedule"
+
+// shootCRDs are the crds of this controller which are used in the shoot,
+// they are copied from config/crd/bases by make manifests
+//
+//go:embed crds/shoot/*.yaml
+var shootCRDs embed.FS
+
+// reconcileShootCRDs creates or updates the crds of this controller in the shoot
+func (r *DurosReconciler) reconcileShootCRDs(ctx context.Context) error {
+	log := r.Log.WithName("shoot-crds")
+
+	crds, err := embeddedCRDs(shootCRDs, "crds/shoot")
+	if err != nil {
+		return err
+	}
+	for _, crd := range crds {
+		obj := &apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: crd.Name}}
+		op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, obj, func() error {
+			mergeAnnotations(obj, crd.Annotations)
+			// the apiserver defaults fields of the spec, it is only replaced if the embedded spec differs
+			if !equality.Semantic.DeepDerivative(crd.Spec, obj.Spec) {
+				obj.Spec = crd.Spec
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("unable to deploy crd %s: %w", crd.Name, err)
+		}
+		if op != controllerutil.OperationResultNone {
+			log.Info("crd", "name", crd.Name, "operation", op)
+		}
+	}
+	return nil
+}
+
+// reconcileSnapshotSchedules takes the volume snapshots of all due snapshot schedules of the shoot and deletes the snapshots exceeding their retention.
+// Failures of a single schedule are reported in its status and do not fail the reconciliation.
+func (r *DurosReconciler) reconcileSnapshotSchedules(ctx context.Context) error {
+	log := r.Log.WithName("snapshot-schedules")
+
+	err := r.reconcileShootCRDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	schedules := &storagev1.SnapshotScheduleList{}
+	err = r.Shoot.List(ctx, schedules)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			log.Info("snapshotschedule crd is not served yet")
+			return nil
+		}
+		return fmt.Errorf("unable to list snapshotschedules: %w", err)
+	}
+
+	now := time.Now()
+	for i := range schedules.Items {
+		s := &schedules.Items[i]
+		log := log.WithValues("schedule", s.Namespace+"/"+s.Name)
+
+		status := s.Status.DeepCopy()
+		err := r.runSnapshotSchedule(ctx, s, now)
+		if err != nil {
+			log.Error(err, "snapshot schedule failed")
+			r.ShootRecorder.Eventf(s, corev1.EventTypeWarning, "SnapshotScheduleFailed", "%s", err)
+			s.Status.LastFailureTime = &metav1.Time{Time: now}
+			s.Status.LastFailureMessage = err.Error()
+		}
+		if equality.Semantic.DeepEqual(status, &s.Status) {
+			continue
+		}
+
+		err = r.Shoot.Status().Update(ctx, s)
+		if err != nil {
+			return fmt.Errorf("unable to update status of snapshotschedule %s/%s: %w", s.Namespace, s.Name, err)
+		}
+	}
+	return nil
+}
+
+// runSnapshotSchedule takes the snapshots of the schedule if it is due and deletes the snapshots exceeding the retention
+func (r *DurosReconciler) runSnapshotSchedule(ctx context.Context, s *storagev1.SnapshotSchedule, now time.Time) error {
+	schedule, err := cron.ParseStandard(s.Spec.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", s.Spec.Schedule, err)
+	}
+
+	last := s.CreationTimestamp
+	if s.Status.LastScheduleTime != nil {
+		last = *s.Status.LastScheduleTime
+	}
+	// missed runs are not caught up, only a single snapshot is taken
+	if !schedule.Next(last.Time).After(now) {
+		s.Status.LastScheduleTime = &metav1.Time{Time: now}
+		err = r.takeSnapshots(ctx, s, now)
+		if err != nil {
+			return err
+		}
+		s.Status.LastSuccessTime = &metav1.Time{Time: now}
+	}
+
+	return r.pruneSnapshots(ctx, s, now)
+}
+
+// takeSnapshots creates a volume snapshot for every bound claim selected by the schedule
+func (r *DurosReconciler) takeSnapshots(ctx context.Context, s *storagev1.SnapshotSchedule, now time.Time) error {
+	log := r.Log.WithName("snapshot-schedules").WithValues("schedule", s.Namespace+"/"+s.Name)
+
+	selector, err := metav1.LabelSelectorAsSelector(&s.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector: %w", err)
+	}
+	claims := &corev1.PersistentVolumeClaimList{}
+	err = r.Shoot.List(ctx, claims, client.InNamespace(s.Namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return fmt.Errorf("unable to list persistent volume claims: %w", err)
+	}
+
+	var errs []error
+	for _, claim := range claims.Items {
+		if claim.Status.Phase != corev1.ClaimBound {
+			continue
+		}
+		snapshot := &snapshotv1.VolumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      snapshotName(s.Name, claim.Name, now),
+				Namespace: s.Namespace,
+				Labels: map[string]string{
+					snapshotScheduleLabel: truncateName(s.Name, validation.LabelValueMaxLength),
+				},
+			},
+			Spec: snapshotv1.VolumeSnapshotSpec{
+				Source: snapshotv1.VolumeSnapshotSource{
+					PersistentVolumeClaimName: &claim.Name,
+				},
+			},
+		}
+		if s.Spec.SnapshotClassName != "" {
+			snapshot.Spec.VolumeSnapshotClassName = &s.Spec.SnapshotClassName
+		}
+		err = r.Shoot.Create(ctx, snapshot)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to create snapshot of %s: %w", claim.Name, err))
+			continue
+		}
+		log.Info("volumesnapshot", "name", snapshot.Name, "claim", claim.Name, "operation", "created")
+	}
+	return errors.Join(errs...)
+}
+
+// pruneSnapshots deletes the snapshots of every claim which exceed the retention of the schedule and counts the remaining snapshots
+func (r *DurosReconciler) pruneSnapshots(ctx context.Context, s *storagev1.SnapshotSchedule, now time.Time) error {
+	log := r.Log.WithName("snapshot-schedules").WithValues("schedule", s.Namespace+"/"+s.Name)
+
+	snapshots := &snapshotv1.VolumeSnapshotList{}
+	err := r.Shoot.List(ctx, snapshots, client.InNamespace(s.Namespace), client.MatchingLabels{snapshotScheduleLabel: truncateName(s.Name, validation.LabelValueMaxLength)})
+	if err != nil {
+		return fmt.Errorf("unable to list volume snapshots: %w", err)
+	}
+
+	byClaim := map[string][]*snapshotv1.VolumeSnapshot{}
+	for i := range snapshots.Items {
+		snapshot := &snapshots.Items[i]
+		if snapshot.DeletionTimestamp != nil {
+			continue
+		}
+		var claim string
+		if snapshot.Spec.Source.PersistentVolumeClaimName != nil {
+			claim = *snapshot.Spec.Source.PersistentVolumeClaimName
+		}
+		byClaim[claim] = append(byClaim[claim], snapshot)
+	}
+
+	var (
+		errs []error
+		kept int
+	)
+	for _, claimSnapshots := range byClaim {
+		prunable := prunableSnapshots(s.Spec.Retention, claimSnapshots, now)
+		kept += len(claimSnapshots) - len(prunable)
+		for _, snapshot := range prunable {
+			err = r.Shoot.Delete(ctx, snapshot)
+			if client.IgnoreNotFound(err) != nil {
+				errs = append(errs, fmt.Errorf("unable to delete snapshot %s: %w", snapshot.Name, err))
+				kept++
+				continue
+			}
+			log.Info("volumesnapshot", "name", snapshot.Name, "operation", "deleted")
+		}
+	}
+	s.Status.Snapshots = kept
+	return errors.Join(errs...)
+}
+
+// prunableSnapshots returns the snapshots of a claim which must be deleted.
+// Only snapshots which are ready to use count towards the retention count, snapshots in progress are only deleted if they exceed the maximum age.
+// A failed snapshot is kept to show its error until a newer snapshot of the claim is taken.
+func prunableSnapshots(retention *storagev1.SnapshotRetention, snapshots []*snapshotv1.VolumeSnapshot, now time.Time) []*snapshotv1.VolumeSnapshot {
+	// newest first
+	snapshots = slices.Clone(snapshots)
+	slices.SortFunc(snapshots, func(a, b *snapshotv1.VolumeSnapshot) int {
+		return b.CreationTimestamp.Compare(a.CreationTimestamp.Time)
+	})
+
+	var (
+		result []*snapshotv1.VolumeSnapshot
+		ready  int
+	)
+	for i, snapshot := range snapshots {
+		var prune bool
+		switch {
+		case snapshot.Status != nil && snapshot.Status.ReadyToUse != nil && *snapshot.Status.ReadyToUse:
+			prune = exceedsRetention(retention, ready, snapshot, now)
+			ready++
+		case snapshot.Status != nil && snapshot.Status.Error != nil:
+			prune = i > 0 || exceedsRetention(retention, 0, snapshot, now)
+		default:
+			prune = exceedsRetention(retention, 0, snapshot, now)
+		}
+		if prune {
+			result = append(result, snapshot)
+		}
+	}
+	return result
+}
+
+// exceedsRetention returns true if the snapshot at the given position of the ready snapshots of a claim, sorted newest first, must be deleted
+func exceedsRetention(retention *storagev1.SnapshotRetention, position int, snapshot *snapshotv1.VolumeSnapshot, now time.Time) bool {
+	if retention == nil {
+		return false
+	}
+	if retention.Count != nil && position >= *retention.Count {
+		return true
+	}
+	if retention.MaxAge != nil && now.Sub(snapshot.CreationTimestamp.Time) > retention.MaxAge.Duration {
+		return true
+	}
+	return false
+}
+
+// snapshotName returns the name of the snapshot of the claim taken by the schedule at the given time,
+// long schedule and claim names are shortened to keep the name within the limit of 253 characters
+func snapshotName(schedule, claim string, now time.Time) string {
+	timestamp := now.UTC().Format("20060102-150405")
+	return truncateName(schedule+"-"+claim, validation.DNS1123SubdomainMaxLength-len(timestamp)-1) + "-" + timestamp
+}
+
+// truncateName shortens the name to maxLen characters by replacing its end with a hash of the whole name, shorter names are returned unchanged
+func truncateName(name string, maxLen int) string {
+	if len(name) <= maxLen {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:8]
+	return strings.TrimRight(name[:maxLen-len(hash)-1], "-.") + "-" + hash
+}
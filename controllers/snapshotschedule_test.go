@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+var testNow = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+// testSnapshot returns a snapshot created the given duration before testNow, state is ready, failed or pending
+func testSnapshot(name string, age time.Duration, state string) *snapshotv1.VolumeSnapshot {
+	snapshot := &snapshotv1.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(testNow.Add(-age))},
+	}
+	switch state {
+	case "ready":
+		snapshot.Status = &snapshotv1.VolumeSnapshotStatus{ReadyToUse: new(true)}
+	case "failed":
+		snapshot.Status = &snapshotv1.VolumeSnapshotStatus{ReadyToUse: new(false), Error: &snapshotv1.VolumeSnapshotError{Message: new("failed")}}
+	}
+	return snapshot
+}
+
+func TestExceedsRetention(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention *storagev1.SnapshotRetention
+		position  int
+		age       time.Duration
+		want      bool
+	}{
+		{
+			name:     "no retention",
+			position: 100,
+			age:      1000 * time.Hour,
+			want:     false,
+		},
+		{
+			name:      "within count",
+			retention: &storagev1.SnapshotRetention{Count: new(3)},
+			position:  2,
+			want:      false,
+		},
+		{
+			name:      "exceeds count",
+			retention: &storagev1.SnapshotRetention{Count: new(3)},
+			position:  3,
+			want:      true,
+		},
+		{
+			name:      "within max age",
+			retention: &storagev1.SnapshotRetention{MaxAge: &metav1.Duration{Duration: 24 * time.Hour}},
+			age:       23 * time.Hour,
+			want:      false,
+		},
+		{
+			name:      "exceeds max age",
+			retention: &storagev1.SnapshotRetention{Count: new(3), MaxAge: &metav1.Duration{Duration: 24 * time.Hour}},
+			age:       25 * time.Hour,
+			want:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exceedsRetention(tt.retention, tt.position, testSnapshot("s", tt.age, "ready"), testNow)
+			if got != tt.want {
+				t.Errorf("exceedsRetention() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrunableSnapshots(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention *storagev1.SnapshotRetention
+		snapshots []*snapshotv1.VolumeSnapshot
+		want      []string
+	}{
+		{
+			name:      "oldest ready snapshots exceeding the count",
+			retention: &storagev1.SnapshotRetention{Count: new(2)},
+			snapshots: []*snapshotv1.VolumeSnapshot{
+				testSnapshot("s3", 3*time.Hour, "ready"),
+				testSnapshot("s1", 1*time.Hour, "ready"),
+				testSnapshot("s2", 2*time.Hour, "ready"),
+			},
+			want: []string{"s3"},
+		},
+		{
+			name:      "failed and pending snapshots do not count",
+			retention: &storagev1.SnapshotRetention{Count: new(2)},
+			snapshots: []*snapshotv1.VolumeSnapshot{
+				testSnapshot("pending", 0, ""),
+				testSnapshot("failed", 1*time.Hour, "failed"),
+				testSnapshot("s2", 2*time.Hour, "ready"),
+				testSnapshot("s3", 3*time.Hour, "ready"),
+			},
+			want: []string{"failed"},
+		},
+		{
+			name:      "newest failed snapshot is kept",
+			retention: &storagev1.SnapshotRetention{Count: new(1)},
+			snapshots: []*snapshotv1.VolumeSnapshot{
+				testSnapshot("failed-1", 1*time.Hour, "failed"),
+				testSnapshot("failed-2", 2*time.Hour, "failed"),
+				testSnapshot("s3", 3*time.Hour, "ready"),
+			},
+			want: []string{"failed-2"},
+		},
+		{
+			name:      "max age applies to all snapshots",
+			retention: &storagev1.SnapshotRetention{MaxAge: &metav1.Duration{Duration: 24 * time.Hour}},
+			snapshots: []*snapshotv1.VolumeSnapshot{
+				testSnapshot("failed", 48*time.Hour, "failed"),
+				testSnapshot("pending", 48*time.Hour, ""),
+				testSnapshot("s1", 1*time.Hour, "ready"),
+				testSnapshot("s2", 48*time.Hour, "ready"),
+			},
+			want: []string{"failed", "pending", "s2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range prunableSnapshots(tt.retention, tt.snapshots, testNow) {
+				got = append(got, s.Name)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("prunableSnapshots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotName(t *testing.T) {
+	if got, want := snapshotName("daily", "data", testNow), "daily-data-20261019-120000"; got != want {
+		t.Errorf("snapshotName() = %s, want %s", got, want)
+	}
+
+	long := snapshotName(strings.Repeat("s", 200), strings.Repeat("c", 200), testNow)
+	if errs := validation.IsDNS1123Subdomain(long); len(errs) > 0 {
+		t.Errorf("snapshotName() = %s is invalid: %v", long, errs)
+	}
+	if other := snapshotName(strings.Repeat("s", 200), strings.Repeat("c", 199)+"d", testNow); other == long {
+		t.Errorf("snapshotName() of different claims is %s for both", long)
+	}
+
+	label := truncateName(strings.Repeat("s", 100)+"."+strings.Repeat("t", 100), validation.LabelValueMaxLength)
+	if errs := validation.IsValidLabelValue(label); len(errs) > 0 {
+		t.Errorf("truncateName() = %s is no valid label value: %v", label, errs)
+	}
+}
+
+func TestReconcileShootCRDs(t *testing.T) {
+	ctx := context.Background()
+	updates := 0
+	shoot := interceptor.NewClient(newFakeClient().(client.WithWatch), interceptor.Funcs{
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			updates++
+			return c.Update(ctx, obj, opts...)
+		},
+	})
+	r := &DurosReconciler{Log: logr.Discard(), Shoot: shoot}
+
+	err := r.reconcileShootCRDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crds := &apiextensionsv1.CustomResourceDefinitionList{}
+	err = shoot.List(ctx, crds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crds.Items) == 0 {
+		t.Fatal("no crds created")
+	}
+
+	// the apiserver defaults the conversion strategy
+	crd := &crds.Items[0]
+	crd.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.NoneConverter}
+	err = shoot.Update(ctx, crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates = 0
+
+	err = r.reconcileShootCRDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updates != 0 {
+		t.Errorf("%d crds updated, want the defaulted crds unchanged", updates)
+	}
+
+	crd.Spec.Versions[0].Served = false
+	err = shoot.Update(ctx, crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates = 0
+
+	err = r.reconcileShootCRDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updates != 1 {
+		t.Errorf("%d crds updated, want the changed crd updated", updates)
+	}
+	got := &apiextensionsv1.CustomResourceDefinition{}
+	err = shoot.Get(ctx, client.ObjectKeyFromObject(crd), got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Spec.Versions[0].Served {
+		t.Error("crd version is not served, want the embedded spec restored")
+	}
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// tracer uses the global tracer provider, spans are dropped unless tracing is configured
+var tracer = otel.Tracer("github.com/metal-stack/duros-controller/controllers")
+
+// startStep starts the span of a reconcile step, the returned function ends the span and records the duration and the error of the step
+func startStep(ctx context.Context, step string) (context.Context, func(error)) {
+	ctx, span := tracer.Start(ctx, step)
+	start := time.Now()
+	return ctx, func(err error) {
+		observeReconcileStep(step, start, err)
+		endSpan(span, err)
+	}
+}
+
+// injectTraceContext adds the trace context of ctx to the outgoing grpc metadata with the global propagator,
+// the lightos api can continue the trace of the call
+func injectTraceContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// metadataCarrier adapts grpc metadata to a propagation.TextMapCarrier
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// endSpan records the error in the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TracingClient creates a span for every call to the wrapped client, it is used for the shoot
+type TracingClient struct {
+	client.Client
+	// Name is the prefix of the span names
+	Name string
+}
+
+func (c *TracingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	ctx, span := c.start(ctx, "Get", obj, key.Namespace, key.Name)
+	err := c.Client.Get(ctx, key, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *TracingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	ctx, span := c.start(ctx, "List", list, "", "")
+	err := c.Client.List(ctx, list, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *TracingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	ctx, span := c.start(ctx, "Create", obj, obj.GetNamespace(), obj.GetName())
+	err := c.Client.Create(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *TracingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	ctx, span := c.start(ctx, "Update", obj, obj.GetNamespace(), obj.GetName())
+	err := c.Client.Update(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *TracingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	ctx, span := c.start(ctx, "Patch", obj, obj.GetNamespace(), obj.GetName())
+	err := c.Client.Patch(ctx, obj, patch, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *TracingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	ctx, span := c.start(ctx, "Delete", obj, obj.GetNamespace(), obj.GetName())
+	err := c.Client.Delete(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *TracingClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	ctx, span := c.start(ctx, "DeleteAllOf", obj, "", "")
+	err := c.Client.DeleteAllOf(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *TracingClient) Status() client.SubResourceWriter {
+	return &tracingStatusWriter{SubResourceWriter: c.Client.Status(), client: c}
+}
+
+func (c *TracingClient) start(ctx context.Context, operation string, obj runtime.Object, namespace, name string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("k8s.namespace", namespace),
+		attribute.String("k8s.name", name),
+	}
+	if gvk, err := c.GroupVersionKindFor(obj); err == nil {
+		attrs = append(attrs, attribute.String("k8s.kind", gvk.Kind))
+	}
+	return tracer.Start(ctx, c.Name+"."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// tracingStatusWriter creates spans for the status updates of the TracingClient
+type tracingStatusWriter struct {
+	client.SubResourceWriter
+	client *TracingClient
+}
+
+func (w *tracingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	ctx, span := w.client.start(ctx, "UpdateStatus", obj, obj.GetNamespace(), obj.GetName())
+	err := w.SubResourceWriter.Update(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (w *tracingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	ctx, span := w.client.start(ctx, "PatchStatus", obj, obj.GetNamespace(), obj.GetName())
+	err := w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+	endSpan(span, err)
+	return err
+}
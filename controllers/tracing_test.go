@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+var (
+	spanExporter     = tracetest.NewInMemoryExporter()
+	spanExporterOnce sync.Once
+)
+
+// recordSpans returns the exporter of all spans ended from now on, the tracer of the package delegates
+// to the first global tracer provider only, so it is registered once for all tests
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	spanExporterOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	spanExporter.Reset()
+	return spanExporter
+}
+
+// spanByName returns the first recorded span with the given name
+func spanByName(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range exporter.GetSpans() {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no span %s recorded", name)
+	return tracetest.SpanStub{}
+}
+
+// spanPaths returns the names of all recorded spans prefixed with the names of their parents
+func spanPaths(exporter *tracetest.InMemoryExporter) []string {
+	var (
+		spans = exporter.GetSpans()
+		names = map[string]tracetest.SpanStub{}
+		paths []string
+	)
+	for _, s := range spans {
+		names[s.SpanContext.SpanID().String()] = s
+	}
+	for _, s := range spans {
+		path := []string{s.Name}
+		for p, ok := names[s.Parent.SpanID().String()]; ok; p, ok = names[p.Parent.SpanID().String()] {
+			path = append([]string{p.Name}, path...)
+		}
+		paths = append(paths, strings.Join(path, "/"))
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+func TestReconcileSpans(t *testing.T) {
+	spans := recordSpans(t)
+
+	duros := &storagev1.Duros{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shoot--p--tracing", Name: "shoot-default-storage"},
+		Spec: storagev1.DurosSpec{
+			MetalProjectID: "project",
+			StorageClasses: []storagev1.StorageClass{{Name: "partition-silver", ReplicaCount: 1}},
+		},
+	}
+	unavailable := &fakeDurosClient{
+		getProject: func() (*durosv2.Project, error) {
+			return nil, status.Error(codes.Unavailable, "connection refused")
+		},
+	}
+	available := &fakeDurosClient{
+		getProject: func() (*durosv2.Project, error) {
+			return &durosv2.Project{Name: "project"}, nil
+		},
+		getCredential: func() (*durosv2.Credential, error) {
+			return nil, status.Error(codes.PermissionDenied, "permission denied")
+		},
+	}
+	durosClient, err := NewFailoverClient(logr.Discard(), "tracing-test", []FailoverEndpoint{
+		{Endpoint: "a", Client: unavailable},
+		{Endpoint: "b", Client: available},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &DurosReconciler{
+		Client:    newFakeClient(duros),
+		Shoot:     &TracingClient{Client: newFakeClient(), Name: "shoot"},
+		Log:       logr.Discard(),
+		Namespace: duros.Namespace,
+		Backends:  map[string]*Backend{DefaultBackend: {Name: DefaultBackend, Client: durosClient}},
+		Recorder:  record.NewFakeRecorder(10),
+	}
+
+	// the credential step fails, the reconciliation is traced up to it and the status update
+	_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: duros.Namespace, Name: duros.Name}})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Reconcile() error = %v, want permission denied", err)
+	}
+
+	paths := spanPaths(spans)
+	for _, want := range []string{
+		"Reconcile",
+		"Reconcile/alerts",
+		"Reconcile/project/duros.GetProject/duros.attempt",
+		"Reconcile/credential/duros.GetCredential/duros.attempt",
+		"Reconcile/status/shoot.Get",
+	} {
+		if !slices.Contains(paths, want) {
+			t.Errorf("span %s not recorded, got %v", want, paths)
+		}
+	}
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "Reconcile") {
+			t.Errorf("span %s is no child of the Reconcile span", path)
+		}
+	}
+
+	attempts := 0
+	for _, s := range spans.GetSpans() {
+		if s.Name == "duros.attempt" && s.Parent.SpanID() == spanByName(t, spans, "duros.GetProject").SpanContext.SpanID() {
+			attempts++
+		}
+	}
+	if attempts != 2 {
+		t.Errorf("duros.GetProject has %d attempt spans, want one per endpoint", attempts)
+	}
+}
+
+// metadataClient records the outgoing grpc metadata of the GetVersion calls
+type metadataClient struct {
+	fakeDurosClient
+	md metadata.MD
+}
+
+func (c *metadataClient) GetVersion(ctx context.Context, in *durosv2.GetVersionRequest, opts ...grpc.CallOption) (*durosv2.GetVersionResponse, error) {
+	c.md, _ = metadata.FromOutgoingContext(ctx)
+	return &durosv2.GetVersionResponse{}, nil
+}
+
+func TestFailoverPropagatesTraceContext(t *testing.T) {
+	spans := recordSpans(t)
+
+	c := &metadataClient{}
+	f, err := NewFailoverClient(logr.Discard(), "tracing-test", []FailoverEndpoint{{Endpoint: "a", Client: c}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "1")
+
+	_, err = f.GetVersion(ctx, &durosv2.GetVersionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempt := spanByName(t, spans, "duros.attempt")
+	traceparent := c.md.Get("traceparent")
+	if len(traceparent) != 1 || !strings.Contains(traceparent[0], attempt.SpanContext.SpanID().String()) {
+		t.Errorf("traceparent = %v, want the context of the attempt span %s", traceparent, attempt.SpanContext.SpanID())
+	}
+	if got := c.md.Get("x-request-id"); len(got) != 1 {
+		t.Errorf("x-request-id = %v, want the metadata of the caller kept", got)
+	}
+}
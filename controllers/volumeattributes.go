@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+// volumeAttributesClassVersions are the api versions of volumeattributesclasses in order of preference,
+// the beta api is served from kubernetes 1.31 if it is enabled in the apiserver, the api is GA since kubernetes 1.34.
+// Unstructured objects are used because the api module of this controller does not contain the v1 types yet.
+var volumeAttributesClassVersions = []schema.GroupVersion{
+	{Group: "storage.k8s.io", Version: "v1"},
+	{Group: "storage.k8s.io", Version: "v1beta1"},
+}
+
+// volumeAttributesClassVersion returns the preferred api version of volumeattributesclasses served by the shoot,
+// false if they are not served at all
+func volumeAttributesClassVersion(rm meta.RESTMapper) (schema.GroupVersion, bool) {
+	for _, gv := range volumeAttributesClassVersions {
+		_, err := rm.KindFor(gv.WithResource("volumeattributesclasses"))
+		if err == nil {
+			return gv, true
+		}
+	}
+	return schema.GroupVersion{}, false
+}
+
+// qosPolicyParameter is the parameter of the lb-csi-plugin which selects the lightos qos policy of a volume
+const qosPolicyParameter = "qos-policy-name"
+
+// deployVolumeAttributesClasses creates or updates the given volumeattributesclasses and deletes all other volumeattributesclasses deployed by this controller.
+// The parameters of a volumeattributesclass are immutable, a changed class is deleted and created again once no claim uses it anymore.
+// Classes waiting for their claims are reported in the VolumeAttributesClassesReady condition.
+func (r *DurosReconciler) deployVolumeAttributesClasses(ctx context.Context, duros *storagev1.Duros, gv schema.GroupVersion, classes []storagev1.VolumeAttributesClass) error {
+	log := r.Log.WithName("storage-csi")
+
+	var (
+		desired   = map[string]bool{}
+		replacing []string
+	)
+	for _, vac := range classes {
+		desired[vac.Name] = true
+
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gv.WithKind("VolumeAttributesClass"))
+		obj.SetName(vac.Name)
+		err := r.Shoot.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		if client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to get volumeattributesclass %s: %w", vac.Name, err)
+		}
+		if obj.GetDeletionTimestamp() != nil {
+			// kept by its protection finalizer until no claim uses it, created again afterwards
+			replacing = append(replacing, vac.Name)
+			continue
+		}
+
+		op, err := controllerutil.CreateOrUpdate(ctx, r.Shoot, obj, func() error {
+			mergeAnnotations(obj, map[string]string{
+				metalClusterDescriptionTag: durosDoNotEditMessage,
+			})
+			obj.Object["driverName"] = provisioner
+			obj.Object["parameters"] = map[string]any{
+				qosPolicyParameter: vac.QoSPolicyName,
+			}
+			return nil
+		})
+		if apierrors.IsInvalid(err) {
+			// driver name and parameters are immutable
+			err = r.Shoot.Delete(ctx, obj)
+			if client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("unable to delete volumeattributesclass %s: %w", vac.Name, err)
+			}
+			log.Info("volumeattributesclass", "name", vac.Name, "operation", "deleted")
+			replacing = append(replacing, vac.Name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Info("volumeattributesclass", "name", vac.Name, "operation", op)
+	}
+
+	condition := metav1.Condition{
+		Type:               storagev1.ConditionVolumeAttributesClassesReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Deployed",
+		Message:            "all volumeattributesclasses are deployed",
+		ObservedGeneration: duros.Generation,
+	}
+	if len(replacing) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Replacing"
+		condition.Message = fmt.Sprintf("the parameters of %s changed, they are created again once no claim uses them anymore", strings.Join(replacing, ", "))
+	}
+	meta.SetStatusCondition(&duros.Status.Conditions, condition)
+
+	existing := &unstructured.UnstructuredList{}
+	existing.SetGroupVersionKind(gv.WithKind("VolumeAttributesClassList"))
+	err := r.Shoot.List(ctx, existing)
+	if err != nil {
+		return fmt.Errorf("unable to list volumeattributesclasses: %w", err)
+	}
+	for i := range existing.Items {
+		obj := &existing.Items[i]
+		driver, _, _ := unstructured.NestedString(obj.Object, "driverName")
+		// classes of the tenant for the lightbits driver are kept
+		if driver != provisioner || !isManaged(obj) || desired[obj.GetName()] || obj.GetDeletionTimestamp() != nil {
+			continue
+		}
+		// classes still used by claims are kept by their protection finalizer until the claims are moved
+		err = r.Shoot.Delete(ctx, obj)
+		if client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to delete volumeattributesclass %s: %w", obj.GetName(), err)
+		}
+		log.Info("volumeattributesclass", "name", obj.GetName(), "operation", "deleted")
+	}
+	return nil
+}
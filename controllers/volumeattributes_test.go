@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+func TestDeployVolumeAttributesClasses(t *testing.T) {
+	gv := volumeAttributesClassVersions[0]
+	vac := func(name, qosPolicy string, managed, terminating bool) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]any{
+			"driverName": provisioner,
+			"parameters": map[string]any{qosPolicyParameter: qosPolicy},
+		}}
+		obj.SetGroupVersionKind(gv.WithKind("VolumeAttributesClass"))
+		obj.SetName(name)
+		if managed {
+			obj.SetAnnotations(map[string]string{metalClusterDescriptionTag: durosDoNotEditMessage})
+		}
+		if terminating {
+			obj.SetFinalizers([]string{"kubernetes.io/vac-protection"})
+			obj.SetDeletionTimestamp(new(metav1.Now()))
+		}
+		return obj
+	}
+	shoot := newFakeClient(
+		vac("gold", "gold-old", true, false),
+		vac("silver", "silver-old", true, true),
+		vac("obsolete", "bronze", true, false),
+		vac("tenant", "tenant", false, false),
+	)
+	r := &DurosReconciler{Log: logr.Discard(), Shoot: shoot}
+	duros := &storagev1.Duros{}
+
+	err := r.deployVolumeAttributesClasses(context.Background(), duros, gv, []storagev1.VolumeAttributesClass{
+		{Name: "gold", QoSPolicyName: "gold"},
+		{Name: "silver", QoSPolicyName: "silver"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gv.WithKind("VolumeAttributesClassList"))
+	err = shoot.List(context.Background(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, obj := range list.Items {
+		names = append(names, obj.GetName())
+		if obj.GetName() == "gold" {
+			if qos, _, _ := unstructured.NestedString(obj.Object, "parameters", qosPolicyParameter); qos != "gold" {
+				t.Errorf("qos policy of gold = %s, want gold", qos)
+			}
+		}
+	}
+	slices.Sort(names)
+	if want := []string{"gold", "silver", "tenant"}; !slices.Equal(names, want) {
+		t.Errorf("volumeattributesclasses = %v, want %v", names, want)
+	}
+
+	c := meta.FindStatusCondition(duros.Status.Conditions, storagev1.ConditionVolumeAttributesClassesReady)
+	if c == nil || c.Status != metav1.ConditionFalse || c.Reason != "Replacing" {
+		t.Errorf("condition = %v, want silver to be replaced", c)
+	}
+}
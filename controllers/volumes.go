@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+const (
+	// maxVolumeStatuses limits the number of volumes listed in the status to keep the object small
+	maxVolumeStatuses = 50
+	// volumeIndexName is the name of the configmap in the namespace of the duros resource which maps the uuids of the volumes
+	// used by the shoot to their kubernetes metadata. The shoot is not watched, the configmap is refreshed by the periodic reconciliation.
+	volumeIndexName = "duros-volumes"
+)
+
+// shootVolumes are the lightbits persistent volumes of the shoot by volume uuid and by name
+type shootVolumes map[string]*corev1.PersistentVolume
+
+// lookup returns the persistent volume of the volume with the given uuid and name, nil if the shoot does not use it
+func (s shootVolumes) lookup(uuid, name string) *corev1.PersistentVolume {
+	if pv, ok := s[uuid]; ok {
+		return pv
+	}
+	return s[name]
+}
+
+// projectVolumes are the volumes and snapshots of the project in a single backend
+type projectVolumes struct {
+	backend   string
+	volumes   []*durosv2.Volume
+	snapshots []*durosv2.Snapshot
+}
+
+// listProjectVolumes lists the volumes and snapshots of the project in all given backends
+func (r *DurosReconciler) listProjectVolumes(ctx context.Context, backends []*Backend, projectID string) ([]projectVolumes, error) {
+	var result []projectVolumes
+	for _, b := range backends {
+		vols, err := b.Client.ListVolumes(ctx, &durosv2.ListVolumesRequest{ProjectName: projectID})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list volumes in backend %s: %w", b.Name, err)
+		}
+		snaps, err := b.Client.ListSnapshots(ctx, &durosv2.ListSnapshotsRequest{ProjectName: projectID})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list snapshots in backend %s: %w", b.Name, err)
+		}
+		result = append(result, projectVolumes{
+			backend:   b.Name,
+			volumes:   vols.GetVolumes(),
+			snapshots: snaps.GetSnapshots(),
+		})
+	}
+	return result, nil
+}
+
+// listShootVolumes returns all lightbits persistent volumes and all persistent volume claims of the shoot,
+// they are listed once per reconciliation and shared by the imports, the claims and the provisioning failures
+func (r *DurosReconciler) listShootVolumes(ctx context.Context) (shootVolumes, []corev1.PersistentVolumeClaim, error) {
+	pvs := &corev1.PersistentVolumeList{}
+	err := r.Shoot.List(ctx, pvs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list persistent volumes: %w", err)
+	}
+	claims := &corev1.PersistentVolumeClaimList{}
+	err = r.Shoot.List(ctx, claims)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list persistent volume claims: %w", err)
+	}
+
+	result := shootVolumes{}
+	for i := range pvs.Items {
+		result.add(&pvs.Items[i])
+	}
+	return result, claims.Items, nil
+}
+
+// add adds the persistent volume if it is provisioned by the lightbits csi plugin
+func (s shootVolumes) add(pv *corev1.PersistentVolume) {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != provisioner {
+		return
+	}
+	// the csi provisioner names the lightos volume like the persistent volume
+	s[pv.Name] = pv
+	if uuid := volumeUUIDFromHandle(pv.Spec.CSI.VolumeHandle); uuid != "" {
+		s[uuid] = pv
+	}
+}
+
+// volumeMetadata is the kubernetes metadata of a volume in the volume index
+type volumeMetadata struct {
+	Name             string            `json:"name"`
+	Backend          string            `json:"backend"`
+	Cluster          string            `json:"cluster"`
+	PersistentVolume string            `json:"persistentVolume"`
+	Namespace        string            `json:"namespace,omitempty"`
+	Claim            string            `json:"claim,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+}
+
+// reconcileVolumeClaims publishes the kubernetes metadata of the volumes used by the shoot.
+// Volumes in lightos carry no metadata, the volume api has neither labels nor a description, therefore the cluster, namespace,
+// claim and the selected labels of the claim of every volume are written into the volume index configmap next to the duros resource
+// and into the listed volumes of the status. Both are refreshed on every reconciliation, relabelled claims show up within 30 seconds.
+func (r *DurosReconciler) reconcileVolumeClaims(ctx context.Context, duros *storagev1.Duros, pvs []projectVolumes, shoot shootVolumes, claims []corev1.PersistentVolumeClaim) error {
+	log := r.Log.WithName("claims")
+
+	index := volumeIndex(duros, pvs, shoot, claims, r.VolumeLabelKeys)
+
+	for i := range duros.Status.Volumes.Items {
+		item := &duros.Status.Volumes.Items[i]
+		m, ok := index[item.UUID]
+		if !ok {
+			continue
+		}
+		item.PersistentVolume = m.PersistentVolume
+		if m.Claim != "" {
+			item.Claim = types.NamespacedName{Namespace: m.Namespace, Name: m.Claim}.String()
+		}
+		item.Labels = m.Labels
+	}
+
+	data := map[string]string{}
+	for uuid, m := range index {
+		js, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		data[uuid] = string(js)
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: volumeIndexName, Namespace: r.Namespace}}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		metav1.SetMetaDataAnnotation(&cm.ObjectMeta, metalClusterDescriptionTag, durosDoNotEditMessage)
+		cm.Data = data
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to deploy volume index: %w", err)
+	}
+	log.Info("configmap", "name", cm.Name, "operation", op)
+	return nil
+}
+
+// volumeIndex returns the metadata of all volumes of the project which are used by a persistent volume of the shoot by volume uuid
+func volumeIndex(duros *storagev1.Duros, pvs []projectVolumes, shoot shootVolumes, claims []corev1.PersistentVolumeClaim, labelKeys []string) map[string]volumeMetadata {
+	cluster := duros.Namespace
+	if duros.Spec.ProjectMetadata != nil && duros.Spec.ProjectMetadata.ClusterName != "" {
+		cluster = duros.Spec.ProjectMetadata.ClusterName
+	}
+
+	claimLabels := map[types.NamespacedName]map[string]string{}
+	for _, c := range claims {
+		claimLabels[types.NamespacedName{Namespace: c.Namespace, Name: c.Name}] = c.Labels
+	}
+
+	index := map[string]volumeMetadata{}
+	for _, p := range pvs {
+		for _, v := range p.volumes {
+			pv := shoot.lookup(v.GetUUID(), v.GetName())
+			if pv == nil {
+				continue
+			}
+			m := volumeMetadata{
+				Name:             v.GetName(),
+				Backend:          p.backend,
+				Cluster:          cluster,
+				PersistentVolume: pv.Name,
+			}
+			if ref := pv.Spec.ClaimRef; ref != nil {
+				m.Namespace = ref.Namespace
+				m.Claim = ref.Name
+				for _, k := range labelKeys {
+					if value, ok := claimLabels[types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}][k]; ok {
+						if m.Labels == nil {
+							m.Labels = map[string]string{}
+						}
+						m.Labels[k] = value
+					}
+				}
+			}
+			index[v.GetUUID()] = m
+		}
+	}
+	return index
+}
+
+// projectUsage sums up the provisioned capacity and counts the volumes and snapshots of the project in all backends
+func projectUsage(pvs []projectVolumes) (capacity resource.Quantity, volumes, snapshots int) {
+	var size uint64
+	for _, pv := range pvs {
+		for _, v := range pv.volumes {
+			size += v.GetSize()
+		}
+		volumes += len(pv.volumes)
+		snapshots += len(pv.snapshots)
+	}
+	// #nosec G115 -- the capacity of a lightos cluster is far below math.MaxInt64
+	return *resource.NewQuantity(int64(size), resource.BinarySI), volumes, snapshots
+}
+
+// quotaStatus compares the usage of the project with the given quota
+func quotaStatus(quota *storagev1.Quota, pvs []projectVolumes) *storagev1.QuotaStatus {
+	used, volumes, snapshots := projectUsage(pvs)
+	status := &storagev1.QuotaStatus{
+		Hard: *quota.DeepCopy(),
+		Used: storagev1.Quota{
+			Capacity:  &used,
+			Volumes:   &volumes,
+			Snapshots: &snapshots,
+		},
+	}
+
+	if quota.Capacity != nil && used.Cmp(*quota.Capacity) > 0 {
+		status.Exceeded = append(status.Exceeded, "capacity")
+	}
+	if quota.Volumes != nil && volumes > *quota.Volumes {
+		status.Exceeded = append(status.Exceeded, "volumes")
+	}
+	if quota.Snapshots != nil && snapshots > *quota.Snapshots {
+		status.Exceeded = append(status.Exceeded, "snapshots")
+	}
+	return status
+}
+
+// volumesStatus summarizes the volumes of the project, only the first maxVolumeStatuses volumes by name are listed
+func volumesStatus(pvs []projectVolumes) *storagev1.VolumesStatus {
+	capacity, count, snapshotCount := projectUsage(pvs)
+	status := &storagev1.VolumesStatus{
+		Count:               count,
+		SnapshotCount:       snapshotCount,
+		ProvisionedCapacity: capacity,
+		LastUpdateTime:      metav1.NewTime(time.Now()),
+	}
+	for _, pv := range pvs {
+		for _, v := range pv.volumes {
+			status.Items = append(status.Items, storagev1.VolumeStatus{
+				Name:    v.GetName(),
+				UUID:    v.GetUUID(),
+				Backend: pv.backend,
+				Size:    *resource.NewQuantity(int64(v.GetSize()), resource.BinarySI), //nolint:gosec
+
+				Replicas:        int(v.GetReplicaCount()),
+				State:           v.GetState().String(),
+				ProtectionState: v.GetProtectionState().String(),
+			})
+		}
+	}
+
+	slices.SortFunc(status.Items, func(a, b storagev1.VolumeStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(status.Items) > maxVolumeStatuses {
+		status.Items = status.Items[:maxVolumeStatuses]
+		status.Truncated = true
+	}
+	return status
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	durosv2 "github.com/metal-stack/duros-go/api/duros/v2"
+
+	storagev1 "github.com/metal-stack/duros-controller/api/v1"
+)
+
+const gi = 1 << 30
+
+func testProjectVolumes() []projectVolumes {
+	return []projectVolumes{
+		{
+			backend: DefaultBackend,
+			volumes: []*durosv2.Volume{
+				{UUID: "uuid-b", Name: "pvc-b", Size: 10 * gi, ReplicaCount: 3},
+				{UUID: "uuid-a", Name: "pvc-a", Size: 20 * gi, ReplicaCount: 2},
+			},
+			snapshots: []*durosv2.Snapshot{{UUID: "snap-1"}},
+		},
+		{
+			backend:   "capacity",
+			volumes:   []*durosv2.Volume{{UUID: "uuid-c", Name: "pvc-c", Size: 30 * gi, ReplicaCount: 1}},
+			snapshots: []*durosv2.Snapshot{{UUID: "snap-2"}, {UUID: "snap-3"}},
+		},
+	}
+}
+
+func TestQuotaStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		quota        storagev1.Quota
+		wantExceeded []string
+	}{
+		{
+			name:  "no limits",
+			quota: storagev1.Quota{},
+		},
+		{
+			name:  "within quota",
+			quota: storagev1.Quota{Capacity: new(resource.MustParse("60Gi")), Volumes: new(3), Snapshots: new(3)},
+		},
+		{
+			name:         "all exceeded",
+			quota:        storagev1.Quota{Capacity: new(resource.MustParse("59Gi")), Volumes: new(2), Snapshots: new(2)},
+			wantExceeded: []string{"capacity", "volumes", "snapshots"},
+		},
+		{
+			name:         "only volumes exceeded",
+			quota:        storagev1.Quota{Capacity: new(resource.MustParse("1Ti")), Volumes: new(1)},
+			wantExceeded: []string{"volumes"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := quotaStatus(&tt.quota, testProjectVolumes())
+			if got.Used.Capacity.Cmp(resource.MustParse("60Gi")) != 0 {
+				t.Errorf("used capacity = %s, want 60Gi", got.Used.Capacity)
+			}
+			if *got.Used.Volumes != 3 || *got.Used.Snapshots != 3 {
+				t.Errorf("used volumes = %d, snapshots = %d, want 3 and 3", *got.Used.Volumes, *got.Used.Snapshots)
+			}
+			if !slices.Equal(got.Exceeded, tt.wantExceeded) {
+				t.Errorf("exceeded = %v, want %v", got.Exceeded, tt.wantExceeded)
+			}
+		})
+	}
+}
+
+func TestVolumesStatus(t *testing.T) {
+	got := volumesStatus(testProjectVolumes())
+	if got.Count != 3 || got.SnapshotCount != 3 {
+		t.Errorf("count = %d, snapshotCount = %d, want 3 and 3", got.Count, got.SnapshotCount)
+	}
+	if got.ProvisionedCapacity.Cmp(resource.MustParse("60Gi")) != 0 {
+		t.Errorf("provisionedCapacity = %s, want 60Gi", &got.ProvisionedCapacity)
+	}
+	var names []string
+	for _, item := range got.Items {
+		names = append(names, item.Backend+"/"+item.Name)
+	}
+	if want := []string{"default/pvc-a", "default/pvc-b", "capacity/pvc-c"}; !slices.Equal(names, want) {
+		t.Errorf("items = %v, want %v", names, want)
+	}
+	if got.Truncated {
+		t.Error("truncated, want all items")
+	}
+}
+
+func TestVolumesStatusTruncated(t *testing.T) {
+	pv := projectVolumes{backend: DefaultBackend}
+	for i := range maxVolumeStatuses + 10 {
+		pv.volumes = append(pv.volumes, &durosv2.Volume{UUID: fmt.Sprintf("uuid-%03d", i), Name: fmt.Sprintf("pvc-%03d", i), Size: gi})
+	}
+
+	got := volumesStatus([]projectVolumes{pv})
+	if got.Count != maxVolumeStatuses+10 {
+		t.Errorf("count = %d, want %d", got.Count, maxVolumeStatuses+10)
+	}
+	if len(got.Items) != maxVolumeStatuses || !got.Truncated {
+		t.Errorf("items = %d, truncated = %t, want %d items and truncated", len(got.Items), got.Truncated, maxVolumeStatuses)
+	}
+	if got.Items[0].Name != "pvc-000" {
+		t.Errorf("first item = %s, want pvc-000", got.Items[0].Name)
+	}
+}
+
+func TestVolumeIndex(t *testing.T) {
+	duros := &storagev1.Duros{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shoot--p--c"},
+		Spec:       storagev1.DurosSpec{ProjectMetadata: &storagev1.ProjectMetadata{ClusterName: "c"}},
+	}
+	shoot := shootVolumes{}
+	shoot.add(&corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-a"},
+		Spec: corev1.PersistentVolumeSpec{
+			ClaimRef:               &corev1.ObjectReference{Namespace: "app", Name: "data"},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: provisioner, VolumeHandle: "mgmt:10.0.0.1:443|nguid:uuid-a|proj:p|scheme:grpcs"}},
+		},
+	})
+	shoot.add(&corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-c"},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: provisioner}},
+		},
+	})
+	claims := []corev1.PersistentVolumeClaim{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "data", Labels: map[string]string{"team": "storage", "other": "ignored"}}},
+	}
+
+	got := volumeIndex(duros, testProjectVolumes(), shoot, claims, []string{"team"})
+	want := map[string]volumeMetadata{
+		"uuid-a": {Name: "pvc-a", Backend: DefaultBackend, Cluster: "c", PersistentVolume: "pvc-a", Namespace: "app", Claim: "data", Labels: map[string]string{"team": "storage"}},
+		"uuid-c": {Name: "pvc-c", Backend: "capacity", Cluster: "c", PersistentVolume: "pvc-c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("index = %v, want %v", got, want)
+	}
+}
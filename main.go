@@ -23,25 +23,39 @@ import (
 	"log/slog"
 	"net"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/go-logr/logr"
 	v2 "github.com/metal-stack/duros-go/api/duros/v2"
 	"github.com/metal-stack/v"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/yaml"
 
 	duroscontrollerv1 "github.com/metal-stack/duros-controller/api/v1"
 	"github.com/metal-stack/duros-controller/controllers"
@@ -60,6 +74,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(duroscontrollerv1.AddToScheme(scheme))
 	utilruntime.Must(snapshotv1.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -73,7 +88,22 @@ func main() {
 		adminKey             string
 		endpoints            string
 		namespace            string
-		// apiEndpoint is the duros-grpc-proxy with client cert validation
+		discoverEndpoints    bool
+		discoveryInterval    time.Duration
+		healthInterval       time.Duration
+		backendsConfig       string
+		orphanCleanup        bool
+		orphanGracePeriod    time.Duration
+		volumeLabelKeys      string
+		volumeHealthMonitor  bool
+		prometheusRule       bool
+		alertThresholds      controllers.AlertThresholds
+		prometheusRuleLabels string
+		eventInterval        time.Duration
+		otlpEndpoint         string
+		otlpInsecure         bool
+		traceSampleRatio     float64
+		// apiEndpoint are the duros-grpc-proxies with client cert validation
 		apiEndpoint string
 		apiCA       string
 		apiKey      string
@@ -89,11 +119,29 @@ func main() {
 	flag.StringVar(&adminToken, "admin-token", "/duros/admin-token", "The admin token file for the duros api.")
 	flag.StringVar(&adminKey, "admin-key", "/duros/admin-key", "The admin key file for the duros api.")
 	flag.StringVar(&endpoints, "endpoints", "", "The endpoints, in the form host:port,host:port of the duros api.")
+	flag.BoolVar(&discoverEndpoints, "discover-endpoints", false, "Discover the endpoints from the cluster info of the duros api, the endpoints flag is only used until the first discovery succeeded.")
+	flag.DurationVar(&discoveryInterval, "discovery-interval", 5*time.Minute, "The interval in which the endpoints are discovered.")
+	flag.DurationVar(&healthInterval, "health-interval", time.Minute, "The interval in which the health of the duros clusters is polled.")
 
-	flag.StringVar(&apiEndpoint, "api-endpoint", "", "The api endpoint, in the form host:port of the duros api")
+	flag.StringVar(&apiEndpoint, "api-endpoint", "", "The api endpoints, in the form host:port,host:port of the duros api, they are tried in the given order")
 	flag.StringVar(&apiCA, "api-ca", "", "The api endpoint ca")
 	flag.StringVar(&apiCert, "api-cert", "", "The api endpoint cert")
 	flag.StringVar(&apiKey, "api-key", "", "The api endpoint key")
+	flag.BoolVar(&orphanCleanup, "orphan-cleanup", false, "Delete orphaned volumes after the grace period. Only volumes which were used by a persistent volume of the shoot before they were orphaned are deleted.")
+	flag.DurationVar(&orphanGracePeriod, "orphan-grace-period", 7*24*time.Hour, "The time a volume must be orphaned before it is deleted.")
+	flag.StringVar(&volumeLabelKeys, "volume-label-keys", "", "Comma separated label keys of persistent volume claims which are shown with their volumes in the status.")
+	flag.BoolVar(&volumeHealthMonitor, "volume-health-monitor", false, "Deploy the csi external-health-monitor-controller into the shoot, abnormal volumes are reported as events on their persistent volume claims.")
+	flag.BoolVar(&prometheusRule, "prometheus-rule", false, "Deploy a PrometheusRule with alerts on the metrics of this controller into its namespace.")
+	flag.StringVar(&prometheusRuleLabels, "prometheus-rule-labels", "", "Comma separated key=value labels of the PrometheusRule, e.g. prometheus=seed to match the rule selector of the prometheus.")
+	flag.DurationVar(&alertThresholds.TokenExpiry, "alert-token-expiry", 12*time.Hour, "Alert if the storage class token expires within this duration, it is renewed one day before it expires.")
+	flag.DurationVar(&alertThresholds.DaemonSetDegraded, "alert-daemonset-degraded", 15*time.Minute, "Alert if the csi node daemonset in the shoot is degraded for this duration.")
+	flag.DurationVar(&alertThresholds.APIUnreachable, "alert-api-unreachable", 5*time.Minute, "Alert if no duros api endpoint is reachable for this duration.")
+	flag.DurationVar(&alertThresholds.ReconcileErrors, "alert-reconcile-errors", 15*time.Minute, "Alert if reconcile steps keep failing for this duration.")
+	flag.DurationVar(&eventInterval, "event-interval", 10*time.Minute, "The same event is recorded at most once in this interval on the duros resource.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "The host:port of an otlp grpc collector the traces are exported to, tracing is disabled if empty.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "Connect to the otlp collector without tls.")
+	flag.Float64Var(&traceSampleRatio, "trace-sample-ratio", 1, "The ratio of reconciliations which are traced.")
+	flag.StringVar(&backendsConfig, "backends-config", "", "The path to a yaml file with additional duros backends, storage classes can reference them by name.")
 
 	flag.Parse()
 
@@ -139,9 +187,29 @@ func main() {
 		os.Exit(1)
 	}
 
+	if otlpEndpoint != "" {
+		shutdown, err := setupTracing(context.Background(), otlpEndpoint, otlpInsecure, traceSampleRatio, namespace)
+		if err != nil {
+			setupLog.Error(err, "unable to setup tracing")
+			os.Exit(1)
+		}
+		err = mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			// flush the remaining spans
+			return shutdown(context.Background())
+		}))
+		if err != nil {
+			setupLog.Error(err, "unable to add tracing shutdown")
+			os.Exit(1)
+		}
+		setupLog.Info("exporting traces", "otlp-endpoint", otlpEndpoint)
+	}
+
 	shootClient := mgr.GetClient()
+	shootRecorder := mgr.GetEventRecorderFor("duros-controller")
+	shootRestConfig := mgr.GetConfig()
 	if len(shootKubeconfig) > 0 {
-		shootRestConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		shootRestConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 			&clientcmd.ClientConfigLoadingRules{ExplicitPath: shootKubeconfig},
 			&clientcmd.ConfigOverrides{},
 		).ClientConfig()
@@ -154,93 +222,98 @@ func main() {
 			setupLog.Error(err, "unable to create shoot client")
 			os.Exit(1)
 		}
+		shootClientset, err := kubernetes.NewForConfig(shootRestConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to create shoot clientset")
+			os.Exit(1)
+		}
+		broadcaster := record.NewBroadcaster()
+		broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: shootClientset.CoreV1().Events("")})
+		shootRecorder = broadcaster.NewRecorder(scheme, corev1.EventSource{Component: "duros-controller"})
 	}
-
-	// connect to duros
-
-	at, err := os.ReadFile(adminToken)
-	if err != nil {
-		setupLog.Error(err, "unable to read admin-token from file")
-		os.Exit(1)
-	}
-	ak, err := os.ReadFile(adminKey)
-	if err != nil {
-		setupLog.Error(err, "unable to read admin-key from file")
-		os.Exit(1)
+	if otlpEndpoint != "" {
+		shootClient = &controllers.TracingClient{Client: shootClient, Name: "shoot"}
 	}
-	ctx := context.Background()
-	if err := validateEndpoints(apiEndpoint); err != nil {
-		setupLog.Error(err, "unable to parse api-endpoint")
-		os.Exit(1)
+	// the client of the shoot kubeconfig is not cached, the cached client of the manager does not support field selectors
+	shootReader := client.Reader(shootClient)
+	if len(shootKubeconfig) == 0 {
+		shootReader = mgr.GetAPIReader()
 	}
-	if err := validateEndpoints(endpoints); err != nil {
-		setupLog.Error(err, "unable to parse endpoints")
+	shootDiscovery, err := discovery.NewDiscoveryClientForConfig(shootRestConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to create shoot discovery client")
 		os.Exit(1)
 	}
-	durosConfig := duros.DialConfig{
-		Token:     string(at),
-		Endpoint:  apiEndpoint,
-		Scheme:    duros.GRPCS,
-		Log:       l,
-		UserAgent: "duros-controller:" + v.Version,
-	}
 
-	if apiCA != "" && apiCert != "" && apiKey != "" {
-		setupLog.Info("connecting to api with client cert", "api-endpoint", apiEndpoint)
-		ac, err := os.ReadFile(apiCA)
-		if err != nil {
-			setupLog.Error(err, "unable to read api-ca from file")
-			os.Exit(1)
-		}
-		ace, err := os.ReadFile(apiCert)
+	// connect to duros
+
+	configs := []backendConfig{
+		{
+			Name:              controllers.DefaultBackend,
+			AdminToken:        adminToken,
+			AdminKey:          adminKey,
+			Endpoints:         endpoints,
+			DiscoverEndpoints: discoverEndpoints,
+			APIEndpoint:       apiEndpoint,
+			APICA:             apiCA,
+			APICert:           apiCert,
+			APIKey:            apiKey,
+		},
+	}
+	if backendsConfig != "" {
+		additional, err := readBackendConfigs(backendsConfig)
 		if err != nil {
-			setupLog.Error(err, "unable to read api-cert from file")
+			setupLog.Error(err, "unable to read backends config")
 			os.Exit(1)
 		}
-		ak, err := os.ReadFile(apiKey)
-		if err != nil {
-			setupLog.Error(err, "unable to read api-key from file")
+		configs = append(configs, additional...)
+	}
+
+	ctx := context.Background()
+	backends := map[string]*controllers.Backend{}
+	for _, config := range configs {
+		if _, ok := backends[config.Name]; ok {
+			setupLog.Error(fmt.Errorf("backend %q is configured twice", config.Name), "unable to read backends config")
 			os.Exit(1)
 		}
-		serverName, _, err := net.SplitHostPort(apiEndpoint)
+		b, err := connectBackend(ctx, mgr, l, config, discoveryInterval, healthInterval)
 		if err != nil {
-			setupLog.Error(err, "unable to parse api-endpoint")
+			setupLog.Error(err, "unable to connect to duros", "backend", config.Name)
 			os.Exit(1)
 		}
-
-		creds := &duros.ByteCredentials{
-			CA:         ac,
-			Cert:       ace,
-			Key:        ak,
-			ServerName: serverName,
-		}
-		durosConfig.ByteCredentials = creds
+		backends[b.Name] = b
 	}
 
-	durosClient, err := duros.Dial(durosConfig)
-	if err != nil {
-		setupLog.Error(err, "problem running duros-controller")
-		os.Exit(1)
+	var alerts *controllers.AlertThresholds
+	if prometheusRule {
+		alerts = &alertThresholds
 	}
-	version, err := durosClient.GetVersion(ctx, &v2.GetVersionRequest{})
+	ruleLabels, err := parseLabels(prometheusRuleLabels)
 	if err != nil {
-		setupLog.Error(err, "unable to connect to duros")
+		setupLog.Error(err, "invalid prometheus rule labels")
 		os.Exit(1)
 	}
-	cinfo, err := durosClient.GetClusterInfo(ctx, &v2.GetClusterRequest{})
-	if err != nil {
-		setupLog.Error(err, "unable to query duros api for cluster info")
-		os.Exit(1)
-	}
-	setupLog.Info("connected", "duros version", version.GetApiVersion(), "cluster", cinfo.GetApiEndpoints())
+
 	if err = (&controllers.DurosReconciler{
 		Client:      mgr.GetClient(),
 		Shoot:       shootClient,
+		ShootReader: shootReader,
 		Log:         ctrl.Log.WithName("controllers").WithName("LightBits"),
 		Namespace:   namespace,
-		DurosClient: durosClient,
-		Endpoints:   endpoints,
-		AdminKey:    ak,
+		Backends:    backends,
+		Recorder:    controllers.NewRateLimitedRecorder(mgr.GetEventRecorderFor("duros-controller"), eventInterval),
+
+		ShootRecorder: shootRecorder,
+
+		OrphanCleanup:     orphanCleanup,
+		OrphanGracePeriod: orphanGracePeriod,
+
+		ShootDiscovery:      shootDiscovery,
+		VolumeLabelKeys:     splitNonEmpty(volumeLabelKeys),
+		VolumeHealthMonitor: volumeHealthMonitor,
+		PrometheusRule:      alerts,
+
+		PrometheusRuleLabels: ruleLabels,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LightBits")
 		os.Exit(1)
@@ -254,18 +327,210 @@ func main() {
 	}
 }
 
-func validateEndpoints(endpoints string) error {
-	for endpoint := range strings.SplitSeq(endpoints, ",") {
-		host, port, err := net.SplitHostPort(strings.TrimSpace(endpoint))
+// setupTracing registers a global tracer provider which exports to the otlp collector, the returned function flushes and stops the export
+func setupTracing(ctx context.Context, endpoint string, insecure bool, ratio float64, namespace string) (func(context.Context) error, error) {
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create otlp exporter: %w", err)
+	}
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "duros-controller"),
+		attribute.String("service.version", v.Version),
+		attribute.String("k8s.namespace.name", namespace),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	// the trace context is sent to the lightos api in the grpc metadata
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// backendConfig configures the connection to a single lightos cluster, the fields correspond to the command line flags
+type backendConfig struct {
+	Name              string `json:"name"`
+	AdminToken        string `json:"adminToken"`
+	AdminKey          string `json:"adminKey"`
+	Endpoints         string `json:"endpoints"`
+	DiscoverEndpoints bool   `json:"discoverEndpoints,omitempty"`
+	APIEndpoint       string `json:"apiEndpoint"`
+	APICA             string `json:"apiCA,omitempty"`
+	APICert           string `json:"apiCert,omitempty"`
+	APIKey            string `json:"apiKey,omitempty"`
+}
+
+// splitNonEmpty splits the comma separated list and drops empty entries
+func splitNonEmpty(list string) []string {
+	var result []string
+	for item := range strings.SplitSeq(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// parseLabels parses the comma separated key=value pairs into labels
+func parseLabels(list string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, item := range splitNonEmpty(list) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("label %q is not in the form key=value", item)
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label value %q: %s", value, strings.Join(errs, ", "))
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+func readBackendConfigs(path string) ([]backendConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []backendConfig
+	if err := yaml.UnmarshalStrict(raw, &configs); err != nil {
+		return nil, err
+	}
+	for _, c := range configs {
+		if c.Name == "" {
+			return nil, fmt.Errorf("backend name must not be empty")
+		}
+		// the name is part of the name of the credentials secret in the shoot
+		if errs := validation.IsDNS1123Label(c.Name); len(errs) > 0 {
+			return nil, fmt.Errorf("backend name %q is invalid: %s", c.Name, strings.Join(errs, ", "))
+		}
+	}
+	return configs, nil
+}
+
+func connectBackend(ctx context.Context, mgr ctrl.Manager, l *slog.Logger, config backendConfig, discoveryInterval, healthInterval time.Duration) (*controllers.Backend, error) {
+	at, err := os.ReadFile(config.AdminToken)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read admin-token from file: %w", err)
+	}
+	ak, err := os.ReadFile(config.AdminKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read admin-key from file: %w", err)
+	}
+	if err := controllers.ValidateEndpoints(config.APIEndpoint); err != nil {
+		return nil, fmt.Errorf("unable to parse api-endpoint: %w", err)
+	}
+	if config.Endpoints != "" || !config.DiscoverEndpoints {
+		if err := controllers.ValidateEndpoints(config.Endpoints); err != nil {
+			return nil, fmt.Errorf("unable to parse endpoints: %w", err)
+		}
+	}
+	durosConfig := duros.DialConfig{
+		Token:     string(at),
+		Scheme:    duros.GRPCS,
+		Log:       l,
+		UserAgent: "duros-controller:" + v.Version,
+	}
+
+	var creds *duros.ByteCredentials
+	if config.APICA != "" && config.APICert != "" && config.APIKey != "" {
+		setupLog.Info("connecting to api with client cert", "backend", config.Name, "api-endpoint", config.APIEndpoint)
+		ac, err := os.ReadFile(config.APICA)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read api-ca from file: %w", err)
+		}
+		ace, err := os.ReadFile(config.APICert)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("unable to read api-cert from file: %w", err)
 		}
-		if strings.TrimSpace(host) == "" {
-			return fmt.Errorf("invalid empty host")
+		ak, err := os.ReadFile(config.APIKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read api-key from file: %w", err)
+		}
+		creds = &duros.ByteCredentials{
+			CA:   ac,
+			Cert: ace,
+			Key:  ak,
+		}
+	}
+
+	var apiClients []controllers.FailoverEndpoint
+	for _, endpoint := range splitNonEmpty(config.APIEndpoint) {
+		dialConfig := durosConfig
+		dialConfig.Endpoint = endpoint
+		if creds != nil {
+			serverName, _, err := net.SplitHostPort(endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse api-endpoint: %w", err)
+			}
+			c := *creds
+			c.ServerName = serverName
+			dialConfig.ByteCredentials = &c
+		}
+
+		// duros.Dial accepts no grpc dial options, the calls are traced by the failover client
+		c, err := duros.Dial(dialConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to dial duros api endpoint, skipping", "backend", config.Name, "api-endpoint", endpoint)
+			continue
+		}
+		apiClients = append(apiClients, controllers.FailoverEndpoint{Endpoint: endpoint, Client: c})
+	}
+	if len(apiClients) == 0 {
+		return nil, fmt.Errorf("unable to dial any api endpoint of %s", config.APIEndpoint)
+	}
+
+	durosClient, err := controllers.NewFailoverClient(ctrl.Log.WithName("duros-api").WithValues("backend", config.Name), config.Name, apiClients)
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.Add(durosClient); err != nil {
+		return nil, fmt.Errorf("unable to add duros api health probes: %w", err)
+	}
+	version, err := durosClient.GetVersion(ctx, &v2.GetVersionRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to duros: %w", err)
+	}
+	cinfo, err := durosClient.GetClusterInfo(ctx, &v2.GetClusterRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query duros api for cluster info: %w", err)
+	}
+	setupLog.Info("connected", "backend", config.Name, "duros version", version.GetApiVersion(), "cluster", cinfo.GetApiEndpoints())
+
+	backend := &controllers.Backend{
+		Name:      config.Name,
+		Client:    durosClient,
+		AdminKey:  ak,
+		Endpoints: config.Endpoints,
+		HealthMonitor: &controllers.HealthMonitor{
+			Log:      ctrl.Log.WithName("health").WithValues("backend", config.Name),
+			Name:     config.Name,
+			Client:   durosClient,
+			Interval: healthInterval,
+		},
+	}
+	if err := mgr.Add(backend.HealthMonitor); err != nil {
+		return nil, fmt.Errorf("unable to add health monitor: %w", err)
+	}
+	if config.DiscoverEndpoints {
+		backend.EndpointDiscovery = &controllers.EndpointDiscovery{
+			Log:      ctrl.Log.WithName("endpoint-discovery").WithValues("backend", config.Name),
+			Client:   durosClient,
+			Interval: discoveryInterval,
 		}
-		if _, err = strconv.ParseUint(port, 10, 16); err != nil {
-			return err
+		if err := mgr.Add(backend.EndpointDiscovery); err != nil {
+			return nil, fmt.Errorf("unable to add endpoint discovery: %w", err)
 		}
 	}
-	return nil
+
+	return backend, nil
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/metal-stack/duros-go"
+	v2 "github.com/metal-stack/duros-go/api/duros/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// traceReceiver is an in-process otlp collector which records the exported spans
+type traceReceiver struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	mu    sync.Mutex
+	spans []*tracev1.ResourceSpans
+}
+
+func (r *traceReceiver) Export(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, req.GetResourceSpans()...)
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+// exported returns the names of the exported spans and the string attributes of their resources
+func (r *traceReceiver) exported() ([]string, map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		names      []string
+		attributes = map[string]string{}
+	)
+	for _, rs := range r.spans {
+		for _, kv := range rs.GetResource().GetAttributes() {
+			attributes[kv.GetKey()] = kv.GetValue().GetStringValue()
+		}
+		for _, ss := range rs.GetScopeSpans() {
+			for _, s := range ss.GetSpans() {
+				names = append(names, s.GetName())
+			}
+		}
+	}
+	return names, attributes
+}
+
+func TestSetupTracing(t *testing.T) {
+	sampledParent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	tests := []struct {
+		name     string
+		ratio    float64
+		parent   *trace.SpanContext
+		wantSpan bool
+	}{
+		{name: "sampled", ratio: 1, wantSpan: true},
+		{name: "not sampled", ratio: 0},
+		{name: "sampled parent", ratio: 0, parent: &sampledParent, wantSpan: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			receiver := &traceReceiver{}
+			srv := grpc.NewServer()
+			collectortrace.RegisterTraceServiceServer(srv, receiver)
+			go func() { _ = srv.Serve(lis) }()
+			t.Cleanup(srv.Stop)
+
+			ctx := context.Background()
+			shutdown, err := setupTracing(ctx, lis.Addr().String(), true, tt.ratio, "shoot--p--tracing")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spanCtx := ctx
+			if tt.parent != nil {
+				spanCtx = trace.ContextWithRemoteSpanContext(ctx, *tt.parent)
+			}
+			_, span := otel.Tracer("test").Start(spanCtx, "Reconcile")
+			span.End()
+
+			// the shutdown flushes the batched spans
+			err = shutdown(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names, attributes := receiver.exported()
+			if got := slices.Contains(names, "Reconcile"); got != tt.wantSpan {
+				t.Fatalf("span exported = %t, want %t, got %v", got, tt.wantSpan, names)
+			}
+			if tt.wantSpan && (attributes["service.name"] != "duros-controller" || attributes["k8s.namespace.name"] != "shoot--p--tracing") {
+				t.Errorf("resource attributes = %v, want the service and the namespace of the controller", attributes)
+			}
+			if fields := otel.GetTextMapPropagator().Fields(); !slices.Contains(fields, "traceparent") || !slices.Contains(fields, "baggage") {
+				t.Errorf("propagator fields = %v, want the trace context and the baggage", fields)
+			}
+		})
+	}
+}
+
+// The calls to the lightos api are traced by the failover client because duros.Dial accepts no way to install a grpc stats
+// handler on its connection. The test fails once duros-go accepts dial options or a stats handler, they should be used then.
+func TestDurosDialAcceptsNoStatsHandler(t *testing.T) {
+	var _ func(duros.DialConfig) (v2.DurosAPIClient, error) = duros.Dial
+
+	options := []reflect.Type{
+		reflect.TypeFor[grpc.DialOption](),
+		reflect.TypeFor[[]grpc.DialOption](),
+		reflect.TypeFor[stats.Handler](),
+	}
+	for field := range reflect.TypeFor[duros.DialConfig]().Fields() {
+		if slices.Contains(options, field.Type) {
+			t.Errorf("duros.DialConfig.%s accepts a %s, install the tracing stats handler with it", field.Name, field.Type)
+		}
+	}
+}